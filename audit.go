@@ -0,0 +1,144 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// The actions recorded in the audit stream.
+const (
+	AuditAcquire      = "acquire"
+	AuditExtend       = "extend"
+	AuditRelease      = "release"
+	AuditForceRelease = "force-release"
+	AuditLost         = "lost"
+)
+
+type auditConfig struct {
+	stream string
+	maxLen int64
+}
+
+var audits atomic.Value
+
+func init() {
+	SetAudit("", 0)
+}
+
+// SetAudit makes the locks append every acquire, extend, release, force
+// release and loss to the redis stream stream, capped to about maxLen
+// entries, as an audit log of who held what and when. Each entry has the
+// action, the key, the token and the unix time in milliseconds, and is
+// written with the client of the lock. An empty stream disables the audit.
+func SetAudit(stream string, maxLen int64) {
+	audits.Store(auditConfig{stream: stream, maxLen: maxLen})
+}
+
+// audit appends action on rl to the audit stream, errors are ignored as the
+// audit must not fail the locks.
+func (rl *RedisLock) audit(action string) {
+	auditKey(rl.redis, rl.key, rl.id, action, rl.clock.Now().UnixNano()/1e6)
+}
+
+func auditKey(redis *red.Client, key, token, action string, millis int64) {
+	emit(auditEvents[action], key, token, millis)
+	config := audits.Load().(auditConfig)
+	if config.stream == "" {
+		return
+	}
+
+	redis.XAdd(tempContext, &red.XAddArgs{
+		Stream: config.stream,
+		MaxLen: config.maxLen,
+		Approx: true,
+		Values: []interface{}{
+			"action", action,
+			"key", key,
+			"token", token,
+			"time", strconv.FormatInt(millis, 10),
+		},
+	})
+}
+
+// An AuditEntry is an entry of the audit stream.
+type AuditEntry struct {
+	ID     string
+	Action string
+	Key    string
+	Token  string
+	Time   time.Time
+}
+
+// An Ownership is a span of time a lock was held by a token, reconstructed
+// from the audit stream.
+type Ownership struct {
+	Token string
+	From  time.Time
+	// To is zero if the lock is still held at the end of the entries.
+	To time.Time
+	// End is the action that ended the ownership, empty if still held.
+	End string
+}
+
+// ReadAudit returns the entries of the audit stream about key recorded
+// between from and to, for incident forensics.
+func ReadAudit(ctx context.Context, redis *red.Client, stream, key string, from, to time.Time) ([]AuditEntry, error) {
+	messages, err := redis.XRange(ctx, stream,
+		strconv.FormatInt(from.UnixNano()/1e6, 10), strconv.FormatInt(to.UnixNano()/1e6, 10)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AuditEntry
+	for _, msg := range messages {
+		if msg.Values["key"] != key {
+			continue
+		}
+
+		action, _ := msg.Values["action"].(string)
+		token, _ := msg.Values["token"].(string)
+		value, _ := msg.Values["time"].(string)
+		millis, _ := strconv.ParseInt(value, 10, 64)
+		entries = append(entries, AuditEntry{
+			ID:     msg.ID,
+			Action: action,
+			Key:    key,
+			Token:  token,
+			Time:   time.Unix(0, millis*1e6),
+		})
+	}
+
+	return entries, nil
+}
+
+// Timeline replays the entries of a key, in order, into the spans of time
+// each token held the lock. A new acquire by another token ends the current
+// span, as the previous holder must have expired.
+func Timeline(entries []AuditEntry) []Ownership {
+	var spans []Ownership
+	current := -1 // index of the span still open
+	for _, entry := range entries {
+		switch entry.Action {
+		case AuditAcquire:
+			if current >= 0 && spans[current].Token == entry.Token {
+				continue
+			} else if current >= 0 {
+				spans[current].To = entry.Time
+				spans[current].End = "expired"
+			}
+			spans = append(spans, Ownership{Token: entry.Token, From: entry.Time})
+			current = len(spans) - 1
+		case AuditRelease, AuditForceRelease, AuditLost:
+			if current >= 0 && (spans[current].Token == entry.Token || entry.Action == AuditForceRelease) {
+				spans[current].To = entry.Time
+				spans[current].End = entry.Action
+				current = -1
+			}
+		}
+	}
+
+	return spans
+}
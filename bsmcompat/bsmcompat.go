@@ -0,0 +1,262 @@
+// Package bsmcompat exposes the API of github.com/bsm/redislock on top of
+// the locks of this module, to ease the migration of its users.
+//
+// Unlike bsm/redislock, the TTLs are rounded up to the second and the keys
+// expire 500ms after them, the tolerance of the locks of this module, so a
+// TTL of 100ms holds the key for 1.5s.
+package bsmcompat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	red "github.com/go-redis/redis/v8"
+	redislock "github.com/neccoys/go-redislock"
+	"time"
+)
+
+var (
+	// ErrNotObtained is returned when a lock cannot be obtained.
+	ErrNotObtained = errors.New("redislock: not obtained")
+	// ErrLockNotHeld is returned when trying to release an inactive lock.
+	ErrLockNotHeld = errors.New("redislock: lock not held")
+)
+
+// Client wraps a redis client.
+type Client struct {
+	client *red.Client
+}
+
+// New creates a new Client instance.
+func New(client *red.Client) *Client {
+	return &Client{client: client}
+}
+
+// Obtain tries to obtain a new lock using a key with the given TTL.
+func Obtain(ctx context.Context, client *red.Client, key string, ttl time.Duration, opt *Options) (*Lock, error) {
+	return New(client).Obtain(ctx, key, ttl, opt)
+}
+
+// Obtain tries to obtain a new lock using a key with the given TTL.
+// It returns ErrNotObtained if the lock is held by others and the retry
+// strategy gave up or ctx is done.
+func (c *Client) Obtain(ctx context.Context, key string, ttl time.Duration, opt *Options) (*Lock, error) {
+	token := opt.getToken()
+	if token == "" {
+		var err error
+		if token, err = randomToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata := opt.getMetadata()
+	rl := redislock.NewWithToken(c.client, key, "", token+metadata)
+	rl.SetExpire(seconds(ttl))
+
+	retry := opt.getRetryStrategy()
+	for {
+		ok, err := rl.AcquireCtx(ctx)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			return &Lock{lock: rl, key: key, token: token, metadata: metadata}, nil
+		}
+
+		backoff := retry.NextBackoff()
+		if backoff < 1 {
+			return nil, ErrNotObtained
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ErrNotObtained
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// Lock represents an obtained, distributed lock.
+type Lock struct {
+	lock     *redislock.RedisLock
+	key      string
+	token    string
+	metadata string
+}
+
+// Key returns the redis key used by the lock.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the token value set by the lock.
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Metadata returns the metadata of the lock.
+func (l *Lock) Metadata() string {
+	return l.metadata
+}
+
+// TTL returns the remaining time-to-live. Returns 0 if the lock has expired.
+func (l *Lock) TTL(ctx context.Context) (time.Duration, error) {
+	ttl, err := l.lock.Validity(ctx)
+	if errors.Is(err, redislock.ErrNotHeld) {
+		return 0, nil
+	}
+
+	return ttl, err
+}
+
+// Refresh extends the lock with a new TTL. It returns ErrNotObtained if
+// refresh is unsuccessful.
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration, opt *Options) error {
+	l.lock.SetExpire(seconds(ttl))
+	ok, err := l.lock.ExtendCtx(ctx)
+	if errors.Is(err, redislock.ErrInvalidState) {
+		return ErrNotObtained
+	} else if err != nil {
+		return err
+	} else if !ok {
+		return ErrNotObtained
+	}
+
+	return nil
+}
+
+// Release manually releases the lock. It returns ErrLockNotHeld if the lock
+// is not held.
+func (l *Lock) Release(ctx context.Context) error {
+	ok, err := l.lock.ReleaseCtx(ctx)
+	if errors.Is(err, redislock.ErrInvalidState) {
+		return ErrLockNotHeld
+	} else if err != nil {
+		return err
+	} else if !ok {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+// Options describe the options for the lock.
+type Options struct {
+	// RetryStrategy allows to customise the lock retry strategy.
+	// Default: do not retry
+	RetryStrategy RetryStrategy
+	// Metadata string is appended to the lock token.
+	Metadata string
+	// Token is a unique value that is used to identify the lock. By default,
+	// a random token is generated.
+	Token string
+}
+
+func (o *Options) getMetadata() string {
+	if o != nil {
+		return o.Metadata
+	}
+	return ""
+}
+
+func (o *Options) getToken() string {
+	if o != nil {
+		return o.Token
+	}
+	return ""
+}
+
+func (o *Options) getRetryStrategy() RetryStrategy {
+	if o != nil && o.RetryStrategy != nil {
+		return o.RetryStrategy
+	}
+	return NoRetry()
+}
+
+// RetryStrategy allows to customise the lock retry strategy.
+type RetryStrategy interface {
+	// NextBackoff returns the next backoff duration.
+	NextBackoff() time.Duration
+}
+
+type linearBackoff time.Duration
+
+// LinearBackoff allows retries regularly with customized intervals.
+func LinearBackoff(backoff time.Duration) RetryStrategy {
+	return linearBackoff(backoff)
+}
+
+// NoRetry acquire the lock only once.
+func NoRetry() RetryStrategy {
+	return linearBackoff(0)
+}
+
+func (r linearBackoff) NextBackoff() time.Duration {
+	return time.Duration(r)
+}
+
+type limitedRetry struct {
+	s   RetryStrategy
+	cnt int64
+	max int64
+}
+
+// LimitRetry limits the number of retries to max attempts.
+func LimitRetry(s RetryStrategy, max int) RetryStrategy {
+	return &limitedRetry{s: s, max: int64(max)}
+}
+
+func (r *limitedRetry) NextBackoff() time.Duration {
+	if r.cnt >= r.max {
+		return 0
+	}
+	r.cnt++
+	return r.s.NextBackoff()
+}
+
+type exponentialBackoff struct {
+	cnt uint
+	min time.Duration
+	max time.Duration
+}
+
+// ExponentialBackoff strategy is an optimization strategy with a retry time
+// of 2**n milliseconds (n means number of times). You can set a minimum
+// and maximum value, the recommended minimum value is not less than 16ms.
+func ExponentialBackoff(min, max time.Duration) RetryStrategy {
+	return &exponentialBackoff{min: min, max: max}
+}
+
+func (r *exponentialBackoff) NextBackoff() time.Duration {
+	r.cnt++
+
+	ms := 2 << 25
+	if r.cnt < 25 {
+		ms = 2 << r.cnt
+	}
+
+	if d := time.Duration(ms) * time.Millisecond; d < r.min {
+		return r.min
+	} else if r.max != 0 && d > r.max {
+		return r.max
+	} else {
+		return d
+	}
+}
+
+// seconds rounds ttl up to the second granularity of the locks.
+func seconds(ttl time.Duration) int {
+	s := int((ttl + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
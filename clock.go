@@ -0,0 +1,66 @@
+package redislock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// A Clock tells the time and waits, so that timeouts and expires can be
+// driven by a fake clock in tests.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// A Timer is a timer created by a Clock.
+type Timer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// clockHolder wraps the Clock so any implementation fits the atomic.Value.
+type clockHolder struct {
+	clock Clock
+}
+
+var defaultClock atomic.Value
+
+func init() {
+	SetDefaultClock(nil)
+}
+
+// SetDefaultClock sets the clock of the locks and sessions created from now
+// on, and of the package helpers such as RunOncePer, Idempotent,
+// WaitForDrain and StartProbe, e.g. a fake clock in tests. A nil clock
+// restores the real one.
+func SetDefaultClock(clock Clock) {
+	if clock == nil {
+		clock = realClock{}
+	}
+	defaultClock.Store(clockHolder{clock: clock})
+}
+
+func getClock() Clock {
+	return defaultClock.Load().(clockHolder).clock
+}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
@@ -0,0 +1,110 @@
+package redislock
+
+import (
+	"encoding/json"
+	red "github.com/go-redis/redis/v8"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// metadataSep separates the token from the metadata in a lock value.
+const metadataSep = "|"
+
+// A Codec encodes the metadata of the locks created by NewWithMetadata,
+// e.g. with msgpack or protobuf for tools that don't read JSON.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the default Codec.
+type JSONCodec struct{}
+
+// Marshal encodes v as JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes the JSON data into v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+var codec atomic.Value
+
+func init() {
+	SetCodec(nil)
+}
+
+// SetCodec sets the Codec of the lock metadata, a nil codec restores
+// JSONCodec.
+func SetCodec(c Codec) {
+	if c == nil {
+		c = JSONCodec{}
+	}
+	codec.Store(&c)
+}
+
+func getCodec() Codec {
+	return *codec.Load().(*Codec)
+}
+
+// NewWithMetadata returns a RedisLock like New whose value also carries the
+// time it was acquired at and metadata about the holder, encoded with the
+// Codec, as "<token>|<acquired at>|<metadata>" so other languages and tools
+// can parse it. The acquisition time is in unix milliseconds, and the tokens
+// must not contain "|".
+func NewWithMetadata(redis *red.Client, key string, prefix string, metadata interface{}) (*RedisLock, error) {
+	data, err := getCodec().Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	token := newToken()
+	rl := newWithID(redis, prefix+key, token+metadataSep+"0"+metadataSep+string(data))
+	rl.token = token
+	rl.metadata = string(data)
+	return rl, nil
+}
+
+// stampValue puts the current time in the value of a lock with metadata
+// before a new hold starts. The value only changes between holds, while no
+// key carries it.
+func (rl *RedisLock) stampValue() {
+	if rl.token == "" {
+		return
+	}
+
+	millis := strconv.FormatInt(rl.clock.Now().UnixNano()/1e6, 10)
+	rl.id = rl.token + metadataSep + millis + metadataSep + rl.metadata
+	rl.idArgs = []interface{}{rl.id}
+	rl.buildLockArgs()
+}
+
+// DecodeMetadata decodes the metadata of the holder into v with the Codec,
+// it returns false if the holder carries none.
+func (i HolderInfo) DecodeMetadata(v interface{}) (bool, error) {
+	if i.Metadata == nil {
+		return false, nil
+	}
+
+	return true, getCodec().Unmarshal(i.Metadata, v)
+}
+
+// parseValue splits a lock value into its token, acquisition time and
+// metadata. The time is zero and the metadata nil unless the value was set
+// by a lock created by NewWithMetadata.
+func parseValue(value string) (string, time.Time, []byte) {
+	parts := strings.SplitN(value, metadataSep, 3)
+	if len(parts) < 3 {
+		return value, time.Time{}, nil
+	}
+
+	millis, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return value, time.Time{}, nil
+	}
+	return parts[0], time.Unix(0, millis*1e6), []byte(parts[2])
+}
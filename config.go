@@ -0,0 +1,83 @@
+package redislock
+
+import (
+	"context"
+	"crypto/tls"
+	red "github.com/go-redis/redis/v8"
+	"time"
+)
+
+// A Config configures the redis client built by NewClientFromConfig. The
+// zero values of the optional fields keep the go-redis defaults.
+type Config struct {
+	Addr     string
+	Username string
+	Password string
+	// Credentials, if set, is called for every new connection to get the
+	// username and password instead of Username and Password, for rotated
+	// credentials such as ElastiCache IAM or Azure AD tokens. An empty
+	// username authenticates with the password only.
+	Credentials func(ctx context.Context) (username, password string, err error)
+	DB          int
+	// TLS enables TLS, nil connects in plain text. TLS 1.2 is the minimum
+	// version unless MinVersion is set.
+	TLS          *tls.Config
+	PoolSize     int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// MaxConnAge closes connections after this age, so that they are
+	// re-authenticated before rotated credentials lapse. Locks are not tied
+	// to connections and survive the reconnects.
+	MaxConnAge time.Duration
+}
+
+// NewClientFromConfig returns a redis client built from c, for callers that
+// don't have one already. The connection is checked with a PING.
+func NewClientFromConfig(c Config) (*red.Client, error) {
+	opts := &red.Options{
+		Addr:         c.Addr,
+		Username:     c.Username,
+		Password:     c.Password,
+		DB:           c.DB,
+		PoolSize:     c.PoolSize,
+		DialTimeout:  c.DialTimeout,
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+		MaxConnAge:   c.MaxConnAge,
+	}
+	if c.Credentials != nil {
+		credentials, db := c.Credentials, c.DB
+		// go-redis selects the DB before OnConnect, so it's selected here
+		// once authenticated.
+		opts.Username, opts.Password, opts.DB = "", "", 0
+		opts.OnConnect = func(ctx context.Context, cn *red.Conn) error {
+			username, password, err := credentials(ctx)
+			if err != nil {
+				return err
+			} else if username == "" {
+				err = cn.Auth(ctx, password).Err()
+			} else {
+				err = cn.AuthACL(ctx, username, password).Err()
+			}
+			if err != nil || db == 0 {
+				return err
+			}
+			return cn.Select(ctx, db).Err()
+		}
+	}
+	if c.TLS != nil {
+		opts.TLSConfig = c.TLS.Clone()
+		if opts.TLSConfig.MinVersion == 0 {
+			opts.TLSConfig.MinVersion = tls.VersionTLS12
+		}
+	}
+
+	client := red.NewClient(opts)
+	if err := client.Ping(tempContext).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
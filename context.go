@@ -0,0 +1,73 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+	"sync/atomic"
+)
+
+// tokenKey is the context key of the token held for a lock key.
+type tokenKey struct {
+	key string
+}
+
+// heldToken is the token of a lock carried by a context, along with the
+// unix nano times its hold started and expires at, and its expire in
+// seconds.
+type heldToken struct {
+	id         string
+	acquiredAt int64
+	heldUntil  int64
+	seconds    uint32
+}
+
+// guardKey is the context key of the Guard of the current operation.
+type guardKey struct{}
+
+// NewContext returns a copy of ctx carrying g, so that nested code can check
+// or extend the lock of the current operation with FromContext.
+func NewContext(ctx context.Context, g *Guard) context.Context {
+	return context.WithValue(ctx, guardKey{}, g)
+}
+
+// FromContext returns the Guard carried by ctx, if any.
+func FromContext(ctx context.Context) (*Guard, bool) {
+	g, ok := ctx.Value(guardKey{}).(*Guard)
+	return g, ok
+}
+
+// ContextWithToken returns a copy of ctx carrying the token of rl, so that
+// functions called with it can share rl's ownership through NewFromContext.
+func ContextWithToken(ctx context.Context, rl *RedisLock) context.Context {
+	seconds := atomic.LoadUint32(&rl.holdSeconds)
+	if seconds == 0 {
+		seconds = atomic.LoadUint32(&rl.seconds)
+	}
+	return context.WithValue(ctx, tokenKey{key: rl.key}, heldToken{
+		id:         rl.id,
+		acquiredAt: atomic.LoadInt64(&rl.acquiredAt),
+		heldUntil:  atomic.LoadInt64(&rl.heldUntil),
+		seconds:    seconds,
+	})
+}
+
+// NewFromContext returns a RedisLock like New. If ctx carries a token for the
+// same key, the returned lock borrows the hold of the caller: it has the
+// caller's expire, Acquire re-enters the lock instead of contending with it,
+// and Release only ends the borrowed hold, leaving the key to the caller.
+// Note that in strict mode re-entering fails with ErrAlreadyHeld.
+func NewFromContext(ctx context.Context, redis *red.Client, key string, prefix string) *RedisLock {
+	if token, ok := ctx.Value(tokenKey{key: prefix + key}).(heldToken); ok {
+		rl := newWithID(redis, prefix+key, token.id)
+		rl.SetExpire(int(token.seconds))
+		// the token is only put in a context by its holder, and the hold
+		// time is counted from its acquisition.
+		rl.state = int32(Held)
+		rl.acquiredAt = token.acquiredAt
+		rl.heldUntil = token.heldUntil
+		rl.borrowed = true
+		return rl
+	}
+
+	return New(redis, key, prefix)
+}
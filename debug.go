@@ -0,0 +1,36 @@
+package redislock
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var debugMode uint32
+
+// SetDebug toggles the diagnostics of the locks at runtime: every acquire,
+// extend and release attempt is printed with its outcome and latency, as
+// well as the retries of TryLockTimeout. It's off by default.
+func SetDebug(enabled bool) {
+	var v uint32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreUint32(&debugMode, v)
+}
+
+func debugEnabled() bool {
+	return atomic.LoadUint32(&debugMode) == 1
+}
+
+// debugOp prints the outcome of the operation op on rl started at start.
+// It also counts the errors, so every redis call of the locks goes through it.
+func (rl *RedisLock) debugOp(op string, start time.Time, ok bool, err error) {
+	rl.countError(err)
+	if !debugEnabled() {
+		return
+	}
+
+	fmt.Printf("redislock op=%s key=%s token=%s ok=%t err=%v latency=%s\n",
+		op, redactKey(rl.key), maskToken(rl.id), ok, err, rl.clock.Now().Sub(start))
+}
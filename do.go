@@ -0,0 +1,244 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// ErrMaxHoldExceeded is returned by DoWithAutoRefresh when the lock was
+// released for being held longer than its max hold.
+var ErrMaxHoldExceeded = errors.New("redislock: max hold exceeded")
+
+// ErrNoProgress is returned by DoWithAutoRefresh when the lock stopped being
+// refreshed for lack of progress.
+var ErrNoProgress = errors.New("redislock: no progress")
+
+// A PanicError is returned by DoWithAutoRefresh in place of a panic of fn
+// when SetRecoverPanics is enabled.
+type PanicError struct {
+	Key   string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("redislock: panic while holding %s: %v", redactKey(e.Key), e.Value)
+}
+
+// DoWithAutoRefresh acquires the lock and runs fn while refreshing the lock
+// in the background. The context passed to fn is canceled as soon as a
+// refresh fails or the lock is found lost, so fn can't outlive its
+// exclusivity, and carries the Guard of the lock for FromContext. The lock
+// is released when fn returns, and also if it panics, before the panic is
+// propagated.
+//
+// It returns ErrNotAcquired if the lock is held by others, and ErrNotHeld if
+// the lock was lost while fn ran, or ErrPreempted if it was preempted, see
+// Preempt, unless fn returned an error of its own.
+func (rl *RedisLock) DoWithAutoRefresh(ctx context.Context, fn func(ctx context.Context) error) error {
+	g, err := rl.AcquireContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer g.Release()
+	if rl.fenceKeys != nil {
+		g.WatchPreemption()
+	}
+
+	ctx, cancel := context.WithCancel(NewContext(ctx, g))
+	defer cancel()
+
+	// lost holds the keepAliveResult of the refresh goroutine.
+	var lost atomic.Value
+	go func() {
+		defer cancel()
+		if err := g.keepAlive(ctx); err != nil {
+			lost.Store(keepAliveResult{err: err})
+		}
+	}()
+
+	// label the profile samples of fn with the lock it holds.
+	labels := pprof.Labels("redislock_key", redactKey(rl.metricKey()), "redislock_holder", maskToken(rl.id))
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		err = rl.call(ctx, fn)
+	})
+	if result, ok := lost.Load().(keepAliveResult); ok && (err == nil || errors.Is(err, context.Canceled)) {
+		return result.err
+	}
+
+	return err
+}
+
+// GuardedTask returns a task for errgroup.Group.Go that runs fn with
+// DoWithAutoRefresh. Failing to acquire the lock or losing it makes the
+// task fail with ErrNotAcquired or ErrNotHeld, which cancels the group when
+// it's created with errgroup.WithContext and ctx is the group's context.
+func GuardedTask(ctx context.Context, lock *RedisLock, fn func(ctx context.Context) error) func() error {
+	return func() error {
+		return lock.DoWithAutoRefresh(ctx, fn)
+	}
+}
+
+// SetRecoverPanics sets whether DoWithAutoRefresh recovers the panics of fn
+// and returns them as a *PanicError instead of propagating them.
+func (rl *RedisLock) SetRecoverPanics(recoverPanics bool) {
+	var v uint32
+	if recoverPanics {
+		v = 1
+	}
+	atomic.StoreUint32(&rl.recoverPanics, v)
+}
+
+func (rl *RedisLock) call(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if atomic.LoadUint32(&rl.recoverPanics) == 1 {
+		defer func() {
+			if v := recover(); v != nil {
+				err = &PanicError{Key: rl.key, Value: v, Stack: debug.Stack()}
+			}
+		}()
+	}
+
+	return fn(ctx)
+}
+
+// SetMaxHold sets the longest DoWithAutoRefresh may hold the lock. Past it
+// the lock is no longer refreshed but released, the context of fn is
+// canceled, onExceeded is called with the key if not nil, and
+// DoWithAutoRefresh returns ErrMaxHoldExceeded. Zero disables the limit.
+func (rl *RedisLock) SetMaxHold(d time.Duration, onExceeded func(key string)) {
+	rl.onMaxHold.Store(onExceeded)
+	atomic.StoreInt64(&rl.maxHold, int64(d))
+}
+
+// A FailurePolicy is what DoWithAutoRefresh does when refreshing the lock
+// fails.
+type FailurePolicy int
+
+const (
+	// GiveUp cancels the context of fn and returns ErrNotHeld, the default.
+	GiveUp FailurePolicy = iota
+	// Retry retries failed refreshes up to the retries set before giving
+	// up. A lock found held by others is given up at once.
+	Retry
+	// Panic panics in the refresh goroutine, crashing the process rather
+	// than letting fn go on without the lock.
+	Panic
+)
+
+type refreshFailure struct {
+	policy  FailurePolicy
+	retries int
+	handler func(key string, err error)
+}
+
+// SetRefreshFailure sets what DoWithAutoRefresh does when refreshing the
+// lock fails, see FailurePolicy. onFailure, if not nil, is called with the
+// key and the error of every failed refresh, ErrNotHeld if the lock is held
+// by others. It must be called before the lock is used.
+func (rl *RedisLock) SetRefreshFailure(policy FailurePolicy, retries int, onFailure func(key string, err error)) {
+	rl.refreshFailure = refreshFailure{policy: policy, retries: retries, handler: onFailure}
+}
+
+// SetProgressTimeout makes DoWithAutoRefresh stop refreshing the lock when
+// fn didn't call Progress on the Guard of its context for d, so that hung
+// work doesn't hold the lock for ever. The context of fn is then canceled,
+// the lock expires unless fn returns first, and DoWithAutoRefresh returns
+// ErrNoProgress. Zero disables the check.
+func (rl *RedisLock) SetProgressTimeout(d time.Duration) {
+	atomic.StoreInt64(&rl.progressTimeout, int64(d))
+}
+
+type keepAliveResult struct {
+	err error
+}
+
+// keepAlive extends the lock at a third of its expire until ctx is done.
+// It returns ErrNotHeld if an extension failed or the lock was lost,
+// ErrPreempted once a preemption request was received, ErrMaxHoldExceeded
+// once the lock was held for its max hold, and ErrNoProgress once fn made
+// no progress for the progress timeout.
+func (g *Guard) keepAlive(ctx context.Context) error {
+	rl := g.lock
+	maxHold := time.Duration(atomic.LoadInt64(&rl.maxHold))
+	progressTimeout := time.Duration(atomic.LoadInt64(&rl.progressTimeout))
+	acquiredAt := time.Unix(0, atomic.LoadInt64(&rl.acquiredAt))
+	for {
+		wait := rl.validity() / 3
+		if maxHold > 0 {
+			left := maxHold - rl.clock.Now().Sub(acquiredAt)
+			if left <= 0 {
+				_, _ = g.Release()
+				if onExceeded, _ := rl.onMaxHold.Load().(func(key string)); onExceeded != nil {
+					onExceeded(rl.key)
+				}
+				return ErrMaxHoldExceeded
+			} else if left < wait {
+				wait = left
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-g.Done():
+			// released because ctx is done, not lost.
+			if ctx.Err() != nil {
+				return nil
+			} else if _, ok := g.PreemptDeadline(); ok {
+				return ErrPreempted
+			}
+			return ErrNotHeld
+		case <-rl.clock.After(wait):
+			if maxHold > 0 && rl.clock.Now().Sub(acquiredAt) >= maxHold {
+				continue
+			}
+			if progressTimeout > 0 && rl.clock.Now().Sub(time.Unix(0, atomic.LoadInt64(&g.progress))) >= progressTimeout {
+				return ErrNoProgress
+			}
+			if err := g.refresh(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// refresh extends the lock applying its refresh failure policy, it returns
+// ErrNotHeld once the refresh is given up.
+func (g *Guard) refresh(ctx context.Context) error {
+	rl := g.lock
+	failure := rl.refreshFailure
+	for attempt := 0; ; attempt++ {
+		ok, err := g.extend(ctx)
+		if err == nil && ok {
+			return nil
+		} else if ctx.Err() != nil {
+			// interrupted because ctx is done, not lost.
+			return nil
+		} else if err == nil {
+			err = ErrNotHeld
+		}
+
+		if failure.handler != nil {
+			failure.handler(rl.key, err)
+		}
+		switch {
+		case failure.policy == Panic:
+			panic(fmt.Errorf("redislock: refreshing %s: %w", redactKey(rl.key), err))
+		case failure.policy != Retry || err == ErrNotHeld || errors.Is(err, ErrInvalidState) || attempt >= failure.retries:
+			return ErrNotHeld
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-g.Done():
+			return ErrNotHeld
+		case <-rl.clock.After(retryInterval):
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sweepEvery is the number of holds between two sweeps of the expired ones.
+const sweepEvery = 1024
+
+var (
+	// heldLocks is the number of RedisLocks this process holds.
+	heldLocks int64
+	// holds is the number of holds tracked, it paces the sweeps.
+	holds int64
+	// held is the set of the *RedisLock this process holds.
+	held sync.Map
+)
+
+// HeldLocks returns the number of locks this process holds and has yet to
+// release, e.g. to report readiness while shutting down. Locks left to
+// expire are no longer counted once their expire elapsed.
+func HeldLocks() int {
+	sweepExpired()
+	return int(atomic.LoadInt64(&heldLocks))
+}
+
+// WaitForDrain waits until this process holds no locks or ctx is done,
+// e.g. in a preStop hook so a pod isn't killed in a critical section.
+func WaitForDrain(ctx context.Context) error {
+	clock := getClock()
+	for HeldLocks() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(retryInterval):
+		}
+	}
+
+	return nil
+}
+
+// track counts rl in the held locks, once per hold.
+func (rl *RedisLock) track() {
+	if atomic.CompareAndSwapUint32(&rl.tracked, 0, 1) {
+		atomic.AddInt64(&heldLocks, 1)
+		held.Store(rl, struct{}{})
+		if atomic.AddInt64(&holds, 1)%sweepEvery == 0 {
+			sweepExpired()
+		}
+	}
+}
+
+// renewHold records that the hold of rl lasts d from now, it must be called
+// before the lock is settled to Held. The key outlives the hold by the
+// tolerance, so the hold only counts as expired once the key is gone.
+func (rl *RedisLock) renewHold(d time.Duration) {
+	atomic.StoreInt64(&rl.heldUntil, rl.clock.Now().Add(d+tolerance*time.Millisecond).UnixNano())
+}
+
+// expired reports whether the hold of rl elapsed without being extended.
+func (rl *RedisLock) expired() bool {
+	return rl.clock.Now().UnixNano() >= atomic.LoadInt64(&rl.heldUntil)
+}
+
+// sweepExpired untracks the held locks whose hold elapsed, they were left
+// to expire rather than released. The locks being extended are skipped.
+func sweepExpired() {
+	held.Range(func(k, _ interface{}) bool {
+		if rl := k.(*RedisLock); rl.State() == Held && rl.expired() {
+			rl.untrack()
+		}
+		return true
+	})
+}
+
+// untrack removes rl from the held locks when it's released, lost or expired.
+func (rl *RedisLock) untrack() {
+	if atomic.CompareAndSwapUint32(&rl.tracked, 1, 0) {
+		held.Delete(rl)
+		atomic.AddInt64(&heldLocks, -1)
+	}
+	rl.releaseSlot()
+}
+
+// SetGroup tags the lock with group, so ReleaseGroup releases it along with
+// the other locks of the group, e.g. all the locks of a job. It must be
+// called before the lock is acquired.
+func (rl *RedisLock) SetGroup(group string) {
+	rl.group = group
+}
+
+// ReleaseGroup releases the locks of group this process holds, and returns
+// the number released. The locks are released one by one, on error the
+// remaining locks are still released and the first error is returned.
+func ReleaseGroup(ctx context.Context, group string) (int, error) {
+	var locks []*RedisLock
+	held.Range(func(k, _ interface{}) bool {
+		if rl := k.(*RedisLock); rl.group == group {
+			locks = append(locks, rl)
+		}
+		return true
+	})
+
+	var released int
+	var firstErr error
+	for _, rl := range locks {
+		ok, err := rl.ReleaseCtx(ctx)
+		if err != nil && !errors.Is(err, ErrInvalidState) && firstErr == nil {
+			firstErr = err
+		} else if ok {
+			released++
+		}
+	}
+
+	return released, firstErr
+}
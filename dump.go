@@ -0,0 +1,104 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+// restoreCommand sets KEYS[1] to ARGV[1] for ARGV[2] milliseconds unless it's
+// held by another token.
+const restoreCommand = `local holder = redis.call("GET", KEYS[1])
+if holder and holder ~= ARGV[1] then
+    return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1`
+
+var restoreScript = red.NewScript(restoreCommand)
+
+// A Snapshot is the state of the locks held by a process, see Dump.
+type Snapshot struct {
+	// TakenAt is when the snapshot was taken, the ttls are counted from it.
+	TakenAt time.Time    `json:"taken_at"`
+	Locks   []DumpedLock `json:"locks"`
+}
+
+// A DumpedLock is a lock of a Snapshot.
+type DumpedLock struct {
+	Key string `json:"key"`
+	// Value is the value of the key, token and metadata included.
+	Value string `json:"value"`
+	// TTL is the remaining ttl of the key when it was dumped.
+	TTL time.Duration `json:"ttl"`
+	// Metadata is the encoded metadata of the holder, nil if it has none.
+	Metadata []byte `json:"metadata,omitempty"`
+}
+
+// Dump returns the locks this process holds, read from redis with their
+// remaining ttls, e.g. before migrating redis in a maintenance window. The
+// locks that are no longer held are left out. On error the locks read so
+// far are returned.
+func Dump(ctx context.Context) (Snapshot, error) {
+	var locks []*RedisLock
+	held.Range(func(k, _ interface{}) bool {
+		if rl := k.(*RedisLock); rl.State() == Held && !rl.expired() {
+			locks = append(locks, rl)
+		}
+		return true
+	})
+
+	snapshot := Snapshot{TakenAt: getClock().Now()}
+	// the locks borrowing a hold share its key, it's dumped once.
+	seen := make(map[string]struct{}, len(locks))
+	for _, rl := range locks {
+		if _, ok := seen[rl.key]; ok {
+			continue
+		}
+
+		pttl, err := pttlScript.Run(ctx, rl.redis, rl.keys, rl.idArgs...).Int64()
+		if err != nil {
+			return snapshot, err
+		} else if pttl <= 0 {
+			continue
+		}
+
+		seen[rl.key] = struct{}{}
+		_, _, metadata := parseValue(rl.id)
+		snapshot.Locks = append(snapshot.Locks, DumpedLock{
+			Key:      rl.key,
+			Value:    rl.id,
+			TTL:      time.Duration(pttl) * time.Millisecond,
+			Metadata: metadata,
+		})
+	}
+
+	return snapshot, nil
+}
+
+// Restore sets the locks of snapshot in redis with their tokens, for the
+// rest of their ttls, and returns the number restored. The locks expired
+// since the snapshot and the keys held by other tokens are skipped, so the
+// processes holding the locks keep their exclusivity once they talk to
+// redis. The locks keep using their own client, so redis is expected to
+// take over their address, e.g. a new server behind the same name.
+func Restore(ctx context.Context, redis *red.Client, snapshot Snapshot) (int, error) {
+	elapsed := getClock().Now().Sub(snapshot.TakenAt)
+	var restored int
+	for _, lock := range snapshot.Locks {
+		ttl := lock.TTL - elapsed
+		if ttl < time.Millisecond {
+			continue
+		}
+
+		n, err := restoreScript.Run(ctx, redis, []string{lock.Key}, lock.Value,
+			strconv.FormatInt(int64(ttl/time.Millisecond), 10)).Int()
+		if err != nil {
+			return restored, err
+		}
+		restored += n
+	}
+
+	return restored, nil
+}
@@ -0,0 +1,65 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	red "github.com/go-redis/redis/v8"
+	"net"
+	"strings"
+)
+
+// An ErrorCategory classifies the failures reported to Metrics.IncError.
+type ErrorCategory string
+
+const (
+	// ErrorTimeout is a timed out acquisition or redis call.
+	ErrorTimeout ErrorCategory = "timeout"
+	// ErrorUnavailable is a failure to reach redis.
+	ErrorUnavailable ErrorCategory = "unavailable"
+	// ErrorLost is a lock found held by others while its owner held it.
+	ErrorLost ErrorCategory = "lost"
+	// ErrorScript is an error reply of redis to a lock script.
+	ErrorScript ErrorCategory = "script"
+	// ErrorRedirect is a cluster redirection, the key isn't on the node.
+	ErrorRedirect ErrorCategory = "redirect"
+	// ErrorOther is any other failure.
+	ErrorOther ErrorCategory = "other"
+)
+
+// classifyError returns the category of err.
+func classifyError(err error) ErrorCategory {
+	var netErr net.Error
+	var redisErr red.Error
+	switch {
+	case errors.Is(err, ErrNotHeld):
+		return ErrorLost
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorUnavailable
+	case errors.As(err, &redisErr):
+		msg := redisErr.Error()
+		if strings.HasPrefix(msg, "MOVED ") || strings.HasPrefix(msg, "ASK ") {
+			return ErrorRedirect
+		} else if strings.HasPrefix(msg, "LOADING") || strings.HasPrefix(msg, "CLUSTERDOWN") ||
+			strings.HasPrefix(msg, "TRYAGAIN") {
+			return ErrorUnavailable
+		}
+		return ErrorScript
+	case errors.Is(err, red.ErrClosed), strings.HasPrefix(err.Error(), "redis: connection pool timeout"):
+		return ErrorUnavailable
+	default:
+		return ErrorOther
+	}
+}
+
+// countError reports err to Metrics, if any. ErrAlreadyHeld is a misuse of
+// the lock rather than a failure, so it's not counted.
+func (rl *RedisLock) countError(err error) {
+	if err != nil && err != ErrAlreadyHeld {
+		getMetrics().IncError(rl.metricKey(), classifyError(err))
+	}
+}
@@ -0,0 +1,109 @@
+package redislock
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An EventType is the type of a lock lifecycle Event.
+type EventType string
+
+// The types of the lock lifecycle events.
+const (
+	EventAcquired      EventType = "acquired"
+	EventContended     EventType = "contended"
+	EventExtended      EventType = "extended"
+	EventReleased      EventType = "released"
+	EventLost          EventType = "lost"
+	EventForceReleased EventType = "force-released"
+)
+
+// eventBuffer is the capacity of the channels returned by Events.
+const eventBuffer = 256
+
+// An Event is a step in the lifecycle of a lock.
+type Event struct {
+	Type EventType `json:"type"`
+	Key  string    `json:"key"`
+	// Token is the token of the lock, or of its holder for EventContended.
+	Token string    `json:"token"`
+	Time  time.Time `json:"time"`
+}
+
+// auditEvents maps the audit actions to their event.
+var auditEvents = map[string]EventType{
+	AuditAcquire:      EventAcquired,
+	AuditExtend:       EventExtended,
+	AuditRelease:      EventReleased,
+	AuditForceRelease: EventForceReleased,
+	AuditLost:         EventLost,
+}
+
+var (
+	// subscribers holds the []chan Event returned by Events.
+	subscribers   atomic.Value
+	subscribersMu sync.Mutex
+	droppedEvents int64
+)
+
+// Events returns a channel receiving the lifecycle events of all the locks
+// of this process from now on, for applications reacting to them. Events
+// are dropped rather than block the locks when the channel is full, see
+// DroppedEvents. The channel is never closed.
+func Events() <-chan Event {
+	return subscribe()
+}
+
+func subscribe() chan Event {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	ch := make(chan Event, eventBuffer)
+	current, _ := subscribers.Load().([]chan Event)
+	next := make([]chan Event, len(current), len(current)+1)
+	copy(next, current)
+	subscribers.Store(append(next, ch))
+	return ch
+}
+
+// unsubscribe stops sending events to ch.
+func unsubscribe(ch chan Event) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	current, _ := subscribers.Load().([]chan Event)
+	next := make([]chan Event, 0, len(current))
+	for _, c := range current {
+		if c != ch {
+			next = append(next, c)
+		}
+	}
+	subscribers.Store(next)
+}
+
+// DroppedEvents returns the number of events dropped for full channels.
+func DroppedEvents() int64 {
+	return atomic.LoadInt64(&droppedEvents)
+}
+
+func emit(t EventType, key, token string, millis int64) {
+	current, _ := subscribers.Load().([]chan Event)
+	if len(current) == 0 {
+		return
+	}
+
+	e := Event{
+		Type:  t,
+		Key:   redactKey(key),
+		Token: token,
+		Time:  time.Unix(0, millis*int64(time.Millisecond)),
+	}
+	for _, ch := range current {
+		select {
+		case ch <- e:
+		default:
+			atomic.AddInt64(&droppedEvents, 1)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package redislock
+
+import "sync"
+
+// A FallbackResult describes an acquisition of a FallbackLock.
+type FallbackResult struct {
+	// Acquired reports whether the lock was acquired.
+	Acquired bool
+	// Index is the position in the chain of the Locker that answered.
+	Index int
+	// Degraded is set when a Locker before Index failed. Processes that
+	// see different stores failing can then hold the lock at the same
+	// time, so exclusivity is not guaranteed.
+	Degraded bool
+	// Errors are the errors of the Lockers skipped before Index.
+	Errors []error
+}
+
+// A FallbackLock acquires a lock on the first available store of an ordered
+// chain of Lockers, e.g. a primary redis then a secondary one in another
+// zone, so that locking survives the outage of a store.
+//
+// The chain only moves on when a Locker fails, a lock held by others on an
+// available store isn't acquired from the next one.
+type FallbackLock struct {
+	lockers []Locker
+	mu      sync.Mutex
+	active  Locker
+}
+
+// NewFallbackLock returns a FallbackLock over lockers, in order.
+func NewFallbackLock(lockers ...Locker) *FallbackLock {
+	return &FallbackLock{
+		lockers: lockers,
+	}
+}
+
+// Acquire acquires the lock.
+func (fl *FallbackLock) Acquire() (bool, error) {
+	result, err := fl.AcquireWithResult()
+	return result.Acquired, err
+}
+
+// AcquireWithResult acquires the lock and reports which store answered.
+// It returns the last error if all the stores failed.
+func (fl *FallbackLock) AcquireWithResult() (FallbackResult, error) {
+	var result FallbackResult
+	for i, locker := range fl.lockers {
+		ok, err := locker.Acquire()
+		if err != nil {
+			result.Errors = append(result.Errors, err)
+			continue
+		}
+
+		result.Acquired = ok
+		result.Index = i
+		result.Degraded = i > 0
+		if ok {
+			fl.mu.Lock()
+			fl.active = locker
+			fl.mu.Unlock()
+		}
+		return result, nil
+	}
+
+	if len(result.Errors) == 0 {
+		return result, nil
+	}
+
+	return result, result.Errors[len(result.Errors)-1]
+}
+
+// Release releases the lock on the store it was acquired from.
+func (fl *FallbackLock) Release() (bool, error) {
+	fl.mu.Lock()
+	active := fl.active
+	fl.active = nil
+	fl.mu.Unlock()
+
+	if active == nil {
+		return false, nil
+	}
+
+	return active.Release()
+}
+
+// Extend extends the lock on the store it was acquired from.
+func (fl *FallbackLock) Extend() (bool, error) {
+	fl.mu.Lock()
+	active := fl.active
+	fl.mu.Unlock()
+
+	if active == nil {
+		return false, nil
+	}
+
+	return active.Extend()
+}
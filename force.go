@@ -0,0 +1,54 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+)
+
+// forceReleaseCommand deletes KEYS[1] unless ARGV[1] is "1" for a dry run,
+// and returns its token. Keys that aren't plain locks are skipped.
+const forceReleaseCommand = `if redis.call("TYPE", KEYS[1])["ok"] ~= "string" then
+    return false
+end
+local token = redis.call("GET", KEYS[1])
+if ARGV[1] ~= "1" then
+    redis.call("DEL", KEYS[1])
+end
+return token`
+
+var forceReleaseScript = red.NewScript(forceReleaseCommand)
+
+// ForceReleaseByPattern deletes the locks whose keys match the SCAN glob
+// pattern whatever their holder, e.g. to clean up the stale locks left by a
+// misbehaving deploy, and returns their keys. With dryRun the keys are only
+// listed. Only plain lock keys are deleted, hashes such as ReentrantLock
+// and HashLock buckets are skipped, and each deletion is recorded in the
+// audit stream as a force release.
+//
+// The holders aren't notified: they find out on their next extend, while
+// another process may already be holding the lock.
+func ForceReleaseByPattern(ctx context.Context, redis *red.Client, pattern string, dryRun bool) ([]string, error) {
+	dry := "0"
+	if dryRun {
+		dry = "1"
+	}
+
+	var keys []string
+	iter := redis.Scan(ctx, 0, pattern, 0).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		token, err := forceReleaseScript.Run(ctx, redis, []string{key}, dry).Text()
+		if err == red.Nil {
+			continue
+		} else if err != nil {
+			return keys, err
+		}
+
+		keys = append(keys, key)
+		if !dryRun {
+			auditKey(redis, key, token, AuditForceRelease, getClock().Now().UnixNano()/1e6)
+		}
+	}
+
+	return keys, iter.Err()
+}
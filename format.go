@@ -0,0 +1,64 @@
+package redislock
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// lockInfo is the diagnostic view of a lock, with its token masked.
+type lockInfo struct {
+	Key   string        `json:"key"`
+	Token string        `json:"token"`
+	TTL   time.Duration `json:"ttl"`
+	State string        `json:"state"`
+	Held  time.Duration `json:"held"`
+}
+
+// String returns a description of the lock safe to log.
+func (rl *RedisLock) String() string {
+	info := rl.info()
+	return fmt.Sprintf("redislock %s (token %s, ttl %s, %s for %s)",
+		info.Key, info.Token, info.TTL, info.State, info.Held)
+}
+
+// MarshalJSON encodes a description of the lock safe to log, with the
+// durations in nanoseconds.
+func (rl *RedisLock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rl.info())
+}
+
+// String returns a description of the guarded lock safe to log.
+func (g *Guard) String() string {
+	return g.lock.String()
+}
+
+// MarshalJSON encodes a description of the guarded lock safe to log.
+func (g *Guard) MarshalJSON() ([]byte, error) {
+	return g.lock.MarshalJSON()
+}
+
+func (rl *RedisLock) info() lockInfo {
+	state := rl.State()
+	info := lockInfo{
+		Key:   redactKey(rl.key),
+		Token: maskToken(rl.id),
+		TTL:   rl.validity(),
+		State: state.String(),
+	}
+	if state == Held || state == Extending {
+		info.Held = rl.clock.Now().Sub(time.Unix(0, atomic.LoadInt64(&rl.acquiredAt)))
+	}
+
+	return info
+}
+
+// maskToken keeps enough of a token to correlate logs without revealing it.
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return "****"
+	}
+
+	return token[:4] + "****"
+}
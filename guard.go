@@ -0,0 +1,154 @@
+package redislock
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Guard is the ownership of an acquired RedisLock. It can only be obtained
+// by a successful acquisition, so releasing or extending through it can't
+// touch a lock that was never held.
+type Guard struct {
+	// progress is the unix nano time of the last call to Progress, it's
+	// kept first for the alignment of its atomic accesses.
+	progress int64
+	// preemptDeadline is the unix nano time the lock is taken over at once
+	// preempted, 0 otherwise.
+	preemptDeadline int64
+	lock            *RedisLock
+	timer           Timer
+	done            chan struct{}
+	once            sync.Once
+}
+
+// AcquireGuard acquires the lock and returns its Guard, or ErrNotAcquired if
+// the lock is held by others.
+func (rl *RedisLock) AcquireGuard() (*Guard, error) {
+	ok, err := rl.Acquire()
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrNotAcquired
+	}
+
+	return newGuard(rl), nil
+}
+
+// AcquireContext acquires the lock like AcquireGuard and binds it to ctx:
+// once ctx is done the lock is released and Done is closed.
+func (rl *RedisLock) AcquireContext(ctx context.Context) (*Guard, error) {
+	ok, _, _, err := rl.acquireFor(ctx, rl.deadlineSeconds(ctx))
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrNotAcquired
+	}
+
+	g := newGuard(rl)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_, _ = g.Release()
+		case <-g.Done():
+		}
+	}()
+	return g, nil
+}
+
+// SetDeadlineExpire makes AcquireContext, and so DoWithAutoRefresh, set the
+// expire of the lock to the time left until the deadline of their context
+// plus margin, rounded up to the second, so that request-scoped locks don't
+// outlive their requests. The derived expire only applies to that hold and
+// its extends, contexts without a deadline keep the expire set by SetExpire.
+func (rl *RedisLock) SetDeadlineExpire(enabled bool, margin time.Duration) {
+	var v uint32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt64(&rl.deadlineMargin, int64(margin))
+	atomic.StoreUint32(&rl.deadlineExpire, v)
+}
+
+// deadlineSeconds returns the expire derived from the deadline of ctx, or 0
+// to keep the expire set by SetExpire.
+func (rl *RedisLock) deadlineSeconds(ctx context.Context) uint32 {
+	deadline, ok := ctx.Deadline()
+	if !ok || atomic.LoadUint32(&rl.deadlineExpire) == 0 {
+		return 0
+	}
+
+	d := deadline.Sub(rl.clock.Now()) + time.Duration(atomic.LoadInt64(&rl.deadlineMargin))
+	seconds := uint32((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	if rl.maxExpire > 0 && seconds > rl.maxExpire && !rl.rejectLongExpire {
+		seconds = rl.maxExpire
+	}
+	return seconds
+}
+
+func newGuard(rl *RedisLock) *Guard {
+	g := &Guard{
+		progress: rl.clock.Now().UnixNano(),
+		lock:     rl,
+		done:     make(chan struct{}),
+	}
+	g.timer = rl.clock.AfterFunc(rl.validity(), g.close)
+	return g
+}
+
+// Done returns a channel that's closed when the lock is released, found lost
+// on Extend, or its expire elapsed without being extended.
+func (g *Guard) Done() <-chan struct{} {
+	return g.done
+}
+
+// Extend resets the expire of the lock. It returns false and closes Done if
+// the lock is no longer held.
+func (g *Guard) Extend() (bool, error) {
+	return g.extend(tempContext)
+}
+
+func (g *Guard) extend(ctx context.Context) (bool, error) {
+	ok, err := g.lock.extend(ctx)
+	if err != nil {
+		return false, err
+	} else if !ok {
+		g.stop()
+		return false, nil
+	}
+
+	g.timer.Reset(g.lock.validity())
+	return true, nil
+}
+
+// Release releases the lock and closes Done.
+func (g *Guard) Release() (bool, error) {
+	defer g.stop()
+	return g.lock.Release()
+}
+
+// Progress signals that the work holding the lock is making progress, see
+// SetProgressTimeout.
+func (g *Guard) Progress() {
+	atomic.StoreInt64(&g.progress, g.lock.clock.Now().UnixNano())
+}
+
+// Token returns the token of the held lock.
+func (g *Guard) Token() string {
+	return g.lock.id
+}
+
+func (g *Guard) close() {
+	g.once.Do(func() {
+		close(g.done)
+	})
+}
+
+func (g *Guard) stop() {
+	g.timer.Stop()
+	g.close()
+}
@@ -0,0 +1,74 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+)
+
+// The guarded scripts run on the data key KEYS[2] only if the lock KEYS[1]
+// is held by ARGV[1].
+const (
+	guardedGetCommand = `if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+    return {0}
+end
+return {1, redis.call("GET", KEYS[2])}`
+	guardedSetCommand = `if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+    return 0
+end
+redis.call("SET", KEYS[2], ARGV[2])
+return 1`
+	guardedDelCommand = `if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+    return -1
+end
+return redis.call("DEL", KEYS[2])`
+)
+
+var (
+	guardedGetScript = red.NewScript(guardedGetCommand)
+	guardedSetScript = red.NewScript(guardedSetCommand)
+	guardedDelScript = red.NewScript(guardedDelCommand)
+)
+
+// GuardedGet returns the value of dataKey if the lock is held, checked in
+// the same script, so the advisory lock protects the data on the server.
+// It returns ErrNotHeld if the lock isn't held and red.Nil if dataKey
+// doesn't exist. On redis cluster both keys must share a hash tag.
+func (rl *RedisLock) GuardedGet(ctx context.Context, dataKey string) (string, error) {
+	resp, err := guardedGetScript.Run(ctx, rl.redis, []string{rl.key, dataKey}, rl.idArgs...).Slice()
+	if err != nil {
+		return "", err
+	} else if len(resp) == 0 || resp[0] != int64(1) {
+		return "", ErrNotHeld
+	}
+
+	if len(resp) < 2 || resp[1] == nil {
+		return "", red.Nil
+	}
+
+	value, _ := resp[1].(string)
+	return value, nil
+}
+
+// GuardedSet sets dataKey to value if the lock is held, or returns ErrNotHeld.
+func (rl *RedisLock) GuardedSet(ctx context.Context, dataKey string, value string) error {
+	resp, err := guardedSetScript.Run(ctx, rl.redis, []string{rl.key, dataKey}, rl.id, value).Int()
+	if err != nil {
+		return err
+	} else if resp != 1 {
+		return ErrNotHeld
+	}
+
+	return nil
+}
+
+// GuardedDel deletes dataKey if the lock is held, or returns ErrNotHeld.
+func (rl *RedisLock) GuardedDel(ctx context.Context, dataKey string) error {
+	resp, err := guardedDelScript.Run(ctx, rl.redis, []string{rl.key, dataKey}, rl.idArgs...).Int()
+	if err != nil {
+		return err
+	} else if resp == -1 {
+		return ErrNotHeld
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package redislock
+
+import (
+	red "github.com/go-redis/redis/v8"
+	"strconv"
+	"sync/atomic"
+)
+
+// The fields of a bucket are lock keys with values of "<expiry in ms>:<token>".
+// The empty field keeps the cursor of the incremental sweep that removes the
+// fields left behind by crashed holders.
+const (
+	hashLockNow = `local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+	hashLockSweep = `local cursor = redis.call("HGET", KEYS[1], "") or "0"
+local scan = redis.call("HSCAN", KEYS[1], cursor, "COUNT", 10)
+for i = 1, #scan[2], 2 do
+    local field, value = scan[2][i], scan[2][i+1]
+    if field ~= "" and tonumber(string.match(value, "^(%d+):")) <= now then
+        redis.call("HDEL", KEYS[1], field)
+    end
+end
+redis.call("HSET", KEYS[1], "", scan[1])
+`
+	hashLockHolder = `local function holder(field)
+    local value = redis.call("HGET", KEYS[1], field)
+    if not value then
+        return nil
+    end
+    local expiry, token = string.match(value, "^(%d+):(.*)$")
+    if tonumber(expiry) <= now then
+        return nil
+    end
+    return token
+end
+`
+	hashLockSet = `local expiry = now + tonumber(ARGV[3])
+redis.call("HSET", KEYS[1], ARGV[1], expiry .. ":" .. ARGV[2])
+if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[3]) then
+    redis.call("PEXPIRE", KEYS[1], ARGV[3])
+end
+`
+	hashLockCommand = hashLockNow + hashLockSweep + hashLockHolder + `local h = holder(ARGV[1])
+if h and h ~= ARGV[2] then
+    return 0
+end
+` + hashLockSet + `return 1`
+	hashExtendCommand = hashLockNow + hashLockHolder + `if holder(ARGV[1]) ~= ARGV[2] then
+    return 0
+end
+` + hashLockSet + `return 1`
+	hashDelCommand = hashLockNow + hashLockHolder + `if holder(ARGV[1]) ~= ARGV[2] then
+    return 0
+end
+return redis.call("HDEL", KEYS[1], ARGV[1])`
+)
+
+var (
+	hashLockScript   = red.NewScript(hashLockCommand)
+	hashExtendScript = red.NewScript(hashExtendCommand)
+	hashDelScript    = red.NewScript(hashDelCommand)
+)
+
+// A HashLock is a lock stored as a field of one of a bounded set of redis
+// hashes rather than as a key of its own, for workloads locking millions of
+// fine-grained entities. The expiry of each field is kept in its value and
+// enforced by the scripts, and every acquire sweeps a few fields of its
+// bucket to remove expired ones.
+type HashLock struct {
+	redis   *red.Client
+	seconds uint32
+	key     string
+	id      string
+	keys    []string
+	args    atomic.Value // []interface{}{key, id, ttl in milliseconds}
+}
+
+// NewHashLock returns a HashLock on key, stored in one of buckets hashes
+// named by prefix and the bucket number.
+func NewHashLock(redis *red.Client, key string, prefix string, buckets int) *HashLock {
+	bucket := prefix + strconv.Itoa(int(hashKey(key)%uint32(buckets)))
+
+	hl := &HashLock{
+		redis: redis,
+		key:   key,
+		id:    newToken(),
+		keys:  []string{bucket},
+	}
+	hl.SetExpire(3)
+	return hl
+}
+
+// Acquire acquires the lock.
+func (hl *HashLock) Acquire() (bool, error) {
+	return hl.run(hashLockScript)
+}
+
+// Release releases the lock.
+func (hl *HashLock) Release() (bool, error) {
+	return hl.run(hashDelScript)
+}
+
+// Extend resets the expire of the lock if it's still held by hl.
+func (hl *HashLock) Extend() (bool, error) {
+	return hl.run(hashExtendScript)
+}
+
+// SetExpire sets the expire.
+func (hl *HashLock) SetExpire(seconds int) {
+	atomic.StoreUint32(&hl.seconds, uint32(seconds))
+	hl.args.Store([]interface{}{hl.key, hl.id, strconv.Itoa(seconds*millisPerSecond + tolerance)})
+}
+
+func (hl *HashLock) run(script *red.Script) (bool, error) {
+	args := hl.args.Load().([]interface{})
+	resp, err := script.Run(tempContext, hl.redis, hl.keys, args...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	reply, ok := resp.(int64)
+	if !ok {
+		return false, nil
+	}
+
+	return reply == 1, nil
+}
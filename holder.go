@@ -0,0 +1,75 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+	"sync/atomic"
+	"time"
+)
+
+// holderCommand returns the value of KEYS[1] and its PTTL.
+const holderCommand = `local holder = redis.call("GET", KEYS[1])
+if not holder then
+    return false
+end
+return {holder, redis.call("PTTL", KEYS[1])}`
+
+var holderScript = red.NewScript(holderCommand)
+
+// A HolderInfo describes the current holder of a lock.
+type HolderInfo struct {
+	// Token is the token of the holder, without the acquisition time and
+	// the metadata of the value.
+	Token string
+	// Metadata is the encoded metadata of the holder, nil if it has none.
+	Metadata []byte
+	// TTL is how long the holder still holds the lock for, like Validity.
+	TTL time.Duration
+	// AcquiredAt is when the lock was acquired. It's carried by the value
+	// of the locks created by NewWithMetadata, for the other locks it's
+	// only known when the holder is the RedisLock asking.
+	AcquiredAt time.Time
+}
+
+// HolderInfo returns the current holder of the lock read in one call, or a
+// zero HolderInfo if the lock is free.
+func (rl *RedisLock) HolderInfo(ctx context.Context) (HolderInfo, error) {
+	info, value, err := inspect(ctx, rl.redis, rl.key)
+	if err == nil && value == rl.id && rl.State() == Held {
+		info.AcquiredAt = time.Unix(0, atomic.LoadInt64(&rl.acquiredAt))
+	}
+
+	return info, err
+}
+
+// Inspect returns the holder of the lock key, its metadata, acquisition time
+// and ttl read atomically in one script, or a zero HolderInfo if the lock is
+// free, for monitoring locks without a RedisLock. The acquisition time is
+// only known for the locks created by NewWithMetadata.
+func Inspect(ctx context.Context, redis *red.Client, key string) (HolderInfo, error) {
+	info, _, err := inspect(ctx, redis, key)
+	return info, err
+}
+
+// inspect returns the holder of key along with the raw value of the key.
+func inspect(ctx context.Context, redis *red.Client, key string) (HolderInfo, string, error) {
+	resp, err := holderScript.Run(ctx, redis, []string{key}).Result()
+	if err == red.Nil {
+		return HolderInfo{}, "", nil
+	} else if err != nil {
+		return HolderInfo{}, "", err
+	}
+
+	var info HolderInfo
+	var value string
+	if reply, ok := resp.([]interface{}); ok && len(reply) == 2 {
+		value, _ = reply[0].(string)
+		info.Token, info.AcquiredAt, info.Metadata = parseValue(value)
+		pttl, _ := reply[1].(int64)
+		if info.TTL = time.Duration(pttl)*time.Millisecond - tolerance*time.Millisecond; info.TTL < 0 {
+			info.TTL = 0
+		}
+	}
+
+	return info, value, nil
+}
@@ -0,0 +1,42 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+	"net/http"
+	"strconv"
+)
+
+// Middleware returns net/http middleware holding a lock on the resource of
+// each request for the duration of its handler, to serialize the mutations
+// of an entity. keyFunc derives the lock key from the request, an empty key
+// lets the request through unlocked.
+//
+// Requests on a locked resource get 423 Locked with a Retry-After of the
+// lock expire, and requests failing to reach redis get 503.
+func Middleware(redis *red.Client, prefix string, keyFunc func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			lock := New(redis, key, prefix)
+			err := lock.DoWithAutoRefresh(r.Context(), func(ctx context.Context) error {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return nil
+			})
+			switch err {
+			case nil, ErrNotHeld:
+				// the response is already written.
+			case ErrNotAcquired:
+				w.Header().Set("Retry-After", strconv.Itoa(int(lock.validity().Seconds())))
+				http.Error(w, http.StatusText(http.StatusLocked), http.StatusLocked)
+			default:
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
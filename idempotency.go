@@ -0,0 +1,88 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+	"time"
+)
+
+const (
+	idempotencyResultSuffix = ":result"
+	processedSuffix         = ":done"
+)
+
+// Idempotent runs fn once for key and stores its result for ttl. Concurrent
+// and later calls with the same key wait for the running call and return
+// the stored result instead of running fn again, e.g. to serve requests
+// carrying the same idempotency key.
+//
+// Failed calls store nothing, so a waiting or later call runs fn again.
+func Idempotent(ctx context.Context, redis *red.Client, key string, ttl time.Duration,
+	fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	resultKey := key + idempotencyResultSuffix
+	lock := New(redis, key, "")
+	for {
+		if result, err := redis.Get(ctx, resultKey).Bytes(); err == nil {
+			return result, nil
+		} else if err != red.Nil {
+			return nil, err
+		}
+
+		var result []byte
+		err := lock.DoWithAutoRefresh(ctx, func(ctx context.Context) error {
+			// the holder we waited for may have stored it meanwhile.
+			stored, err := redis.Get(ctx, resultKey).Bytes()
+			if err == nil {
+				result = stored
+				return nil
+			} else if err != red.Nil {
+				return err
+			}
+
+			if result, err = fn(ctx); err != nil {
+				return err
+			}
+
+			return redis.Set(ctx, resultKey, result, ttl).Err()
+		})
+		if err != ErrNotAcquired {
+			return result, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-getClock().After(retryInterval):
+		}
+	}
+}
+
+// ProcessOnce runs fn for the message msgID unless the message is being
+// processed by another consumer or was processed in the last retention,
+// e.g. to skip the redeliveries of an at-least-once queue. It returns whether
+// fn ran in this call.
+//
+// Failed messages aren't marked as processed, so a redelivery runs fn again.
+func ProcessOnce(ctx context.Context, redis *red.Client, msgID string, retention time.Duration,
+	fn func(ctx context.Context) error) (bool, error) {
+	doneKey := msgID + processedSuffix
+	var ran bool
+	err := New(redis, msgID, "").DoWithAutoRefresh(ctx, func(ctx context.Context) error {
+		if n, err := redis.Exists(ctx, doneKey).Result(); err != nil || n > 0 {
+			return err
+		}
+
+		if err := fn(ctx); err != nil {
+			return err
+		}
+
+		ran = true
+		return redis.Set(ctx, doneKey, 1, retention).Err()
+	})
+	if err == ErrNotAcquired {
+		// in flight on another consumer.
+		return false, nil
+	}
+
+	return ran, err
+}
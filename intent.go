@@ -0,0 +1,89 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	red "github.com/go-redis/redis/v8"
+	"time"
+)
+
+// confirmCommand acquires KEYS[1] if the intent KEYS[2] is held by ARGV[1],
+// and drops the intent once the lock is taken.
+const confirmCommand = `if redis.call("GET", KEYS[2]) ~= ARGV[1] then
+    return -1
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+    redis.call("DEL", KEYS[2])
+    return 1
+end
+return 0`
+
+const intentSuffix = ":intent"
+
+var confirmScript = red.NewScript(confirmCommand)
+
+// ErrNoIntent is returned by Confirm when the intent isn't held.
+var ErrNoIntent = errors.New("redislock: intent not held")
+
+// Intend registers the intent to take the lock without blocking its
+// resource: only one intent may be held at a time, but plain acquires are
+// not affected. A coordinator can reserve the locks a multi-resource
+// operation needs, then Confirm them all or Abort cheaply.
+//
+// The intent expires like the lock. On redis cluster the key must carry a
+// hash tag, as the intent key is derived from it.
+func (rl *RedisLock) Intend(ctx context.Context) (bool, error) {
+	// Confirm sets the lock to the value of the intent.
+	if state := rl.State(); state != Held && state != Extending {
+		rl.stampValue()
+	}
+	ttl := rl.validity() + tolerance*time.Millisecond
+	return rl.redis.SetNX(ctx, rl.key+intentSuffix, rl.id, ttl).Result()
+}
+
+// Confirm turns the held intent into the lock. It returns false if the lock
+// is held by others, the intent is then kept, and ErrNoIntent if the intent
+// isn't held.
+func (rl *RedisLock) Confirm(ctx context.Context) (bool, error) {
+	prev, err := rl.transition("confirm", Acquiring, Unlocked, Lost, Released)
+	if err != nil {
+		return false, err
+	}
+	took, err := rl.beginHold(0)
+	if err != nil {
+		rl.settle(Acquiring, prev)
+		return false, err
+	}
+
+	args := rl.lockArgs.Load().([]interface{})
+	resp, err := confirmScript.Run(ctx, rl.redis, []string{rl.key, rl.key + intentSuffix}, args[:2]...).Int()
+	if err == nil && resp == -1 {
+		err = ErrNoIntent
+	} else if err == nil && resp == 1 && rl.mirrorKeys != nil {
+		var ok bool
+		if ok, err = rl.lockMirror(ctx, 0); !ok {
+			resp = 0
+		}
+	}
+	if err != nil || resp != 1 {
+		if took {
+			rl.releaseSlot()
+		}
+		rl.settle(Acquiring, prev)
+		return false, err
+	}
+
+	rl.startHold(0)
+	rl.settle(Acquiring, Held)
+	return true, nil
+}
+
+// Abort drops the held intent.
+func (rl *RedisLock) Abort(ctx context.Context) (bool, error) {
+	resp, err := delScript.Run(ctx, rl.redis, []string{rl.key + intentSuffix}, rl.idArgs...).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return resp == 1, nil
+}
@@ -0,0 +1,30 @@
+package redislock
+
+import (
+	red "github.com/go-redis/redis/v8"
+	"sync/atomic"
+	"time"
+)
+
+// pubSubKeepAlive is the ping interval in nanoseconds of the subscriptions
+// of YieldRequests and WatchLoss.
+var pubSubKeepAlive int64 = int64(30 * time.Second)
+
+// SetPubSubKeepAlive sets the interval of the pings on the pub/sub
+// connections listening for yield requests and stolen locks, 30s by
+// default. A connection that misses a ping is reconnected and resubscribed,
+// so lower it below the idle timeout of managed servers or NAT gateways
+// that drop quiet connections. It applies to the subscriptions started
+// after the call.
+//
+// The watchdog of DoWithAutoRefresh needs no pings, it sends an extend
+// every third of the expire on pooled connections.
+func SetPubSubKeepAlive(interval time.Duration) {
+	atomic.StoreInt64(&pubSubKeepAlive, int64(interval))
+}
+
+// channel returns the message channel of sub with the keepalive set.
+func channel(sub *red.PubSub) <-chan *red.Message {
+	interval := time.Duration(atomic.LoadInt64(&pubSubKeepAlive))
+	return sub.Channel(red.WithChannelHealthCheckInterval(interval))
+}
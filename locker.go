@@ -0,0 +1,17 @@
+package redislock
+
+// A Locker is a lock that can be acquired, released and extended, so callers
+// can depend on it rather than on a concrete lock and mock it in tests.
+type Locker interface {
+	Acquire() (bool, error)
+	Release() (bool, error)
+	Extend() (bool, error)
+}
+
+var (
+	_ Locker = (*RedisLock)(nil)
+	_ Locker = (*ReentrantLock)(nil)
+	_ Locker = (*MultiLock)(nil)
+	_ Locker = (*HashLock)(nil)
+	_ Locker = (*FallbackLock)(nil)
+)
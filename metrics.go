@@ -0,0 +1,82 @@
+package redislock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives measurements of the locks, e.g. to record them in
+// prometheus histograms.
+type Metrics interface {
+	// ObserveHoldTime is called on release with how long the lock was held.
+	ObserveHoldTime(key string, d time.Duration)
+	// ObserveWaitTime is called when TryLockTimeout returns with how long
+	// it waited and whether the lock was acquired.
+	ObserveWaitTime(key string, d time.Duration, acquired bool)
+	// IncError is called on every failure with its category, so that
+	// redis being down can be told apart from contention.
+	IncError(key string, category ErrorCategory)
+	// ObserveProbe is called by the probe started with StartProbe with the
+	// round trip of its canary acquire and release, and its error if any.
+	ObserveProbe(key string, d time.Duration, err error)
+}
+
+// metricsHolder wraps the Metrics so any implementation fits the atomic.Value.
+type metricsHolder struct {
+	metrics Metrics
+}
+
+type nopMetrics struct{}
+
+var (
+	metrics    atomic.Value
+	keyGrouper atomic.Value // func(key string) string
+)
+
+func init() {
+	SetMetrics(nil)
+	SetKeyGrouper(nil)
+}
+
+// SetMetrics sets the Metrics receiving the measurements of all the locks,
+// nil disables them.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	metrics.Store(metricsHolder{metrics: m})
+}
+
+// SetKeyGrouper sets the function mapping lock keys to the keys reported to
+// Metrics, e.g. "order:123456" to "order", so that per-entity keys don't
+// explode the cardinality of the metric labels. nil reports the keys as is.
+func SetKeyGrouper(grouper func(key string) string) {
+	if grouper == nil {
+		grouper = func(key string) string {
+			return key
+		}
+	}
+	keyGrouper.Store(grouper)
+}
+
+func getMetrics() Metrics {
+	return metrics.Load().(metricsHolder).metrics
+}
+
+// metricKey returns the key reported to Metrics for rl, its namespace label
+// if it has one, or its grouped key.
+func (rl *RedisLock) metricKey() string {
+	if rl.label != "" {
+		return rl.label
+	}
+
+	return keyGrouper.Load().(func(string) string)(rl.key)
+}
+
+func (nopMetrics) ObserveHoldTime(string, time.Duration) {}
+
+func (nopMetrics) ObserveWaitTime(string, time.Duration, bool) {}
+
+func (nopMetrics) IncError(string, ErrorCategory) {}
+
+func (nopMetrics) ObserveProbe(string, time.Duration, error) {}
@@ -0,0 +1,102 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	red "github.com/go-redis/redis/v8"
+	"strings"
+)
+
+// migrateCommand copies KEYS[1] to KEYS[2] with its remaining ttl, unless the
+// source is gone or the destination already exists.
+const migrateCommand = `local pttl = redis.call("PTTL", KEYS[1])
+if pttl == -2 or redis.call("EXISTS", KEYS[2]) == 1 then
+    return 0
+end
+if pttl < 0 then
+    pttl = 0
+end
+redis.call("RESTORE", KEYS[2], pttl, redis.call("DUMP", KEYS[1]))
+return 1`
+
+var migrateScript = red.NewScript(migrateCommand)
+
+// Migrate copies the live locks under oldPrefix to newPrefix, keeping their
+// tokens and remaining ttls, and returns the number of locks copied. Keys
+// already present under newPrefix are left untouched, and the old keys are
+// kept until they expire or get released.
+//
+// The copies expire with their original ttl, as their holders only extend
+// the old keys. To rename a prefix without losing exclusivity, first deploy
+// the locks under newPrefix with SetMirror on their old key so that they
+// hold and extend both, run Migrate for the locks taken before, and drop the
+// mirrors once no process uses the old prefix.
+//
+// Each key is copied with its destination in one script, so on redis cluster
+// only prefixes sharing a hash tag can be migrated.
+func Migrate(ctx context.Context, redis *red.Client, oldPrefix, newPrefix string) (int, error) {
+	var copied int
+	nested := len(newPrefix) > len(oldPrefix) && strings.HasPrefix(newPrefix, oldPrefix)
+	iter := redis.Scan(ctx, 0, escapeGlob(oldPrefix)+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if nested && strings.HasPrefix(key, newPrefix) {
+			// a copy, as newPrefix extends oldPrefix.
+			continue
+		}
+		n, err := migrateScript.Run(ctx, redis, []string{key, newPrefix + strings.TrimPrefix(key, oldPrefix)}).Int()
+		if err != nil {
+			return copied, err
+		}
+		copied += n
+	}
+
+	return copied, iter.Err()
+}
+
+// ErrMirrored is returned by the operations that don't support a mirror,
+// see SetMirror.
+var ErrMirrored = errors.New("redislock: operation not supported with a mirror")
+
+// SetMirror makes the lock also hold key, a full key, with the same token
+// and expire, e.g. its old key while migrating its prefix with Migrate. The
+// lock is only acquired if both keys are, extends and touches fail if
+// either key was lost, and releases delete both. Steal fails with
+// ErrMirrored. On redis cluster the keys are written in separate calls,
+// except by ExtendAll. An empty key disables the mirror, it must be called
+// before the lock is used.
+func (rl *RedisLock) SetMirror(key string) {
+	if key == "" {
+		rl.mirrorKeys = nil
+		return
+	}
+	rl.mirrorKeys = []string{key}
+}
+
+// lockMirror acquires the mirror key after the lock key, and rolls the lock
+// key back if the mirror is held by others.
+func (rl *RedisLock) lockMirror(ctx context.Context, seconds uint32) (bool, error) {
+	resp, err := lockScript.Run(ctx, rl.redis, rl.mirrorKeys, rl.acquireArgs(seconds)...).Result()
+	if reply, ok := resp.(string); err == nil && ok && reply == "OK" {
+		return true, nil
+	} else if err == red.Nil {
+		err = nil
+	}
+
+	_, _ = delScript.Run(ctx, rl.redis, rl.keys, rl.idArgs...).Result()
+	return false, err
+}
+
+// escapeGlob escapes the glob special characters of s for SCAN MATCH.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
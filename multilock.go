@@ -0,0 +1,235 @@
+package redislock
+
+import (
+	"errors"
+	"fmt"
+	red "github.com/go-redis/redis/v8"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// lockAllCommand sets all of KEYS to ARGV[1] if none is held by another token,
+// or returns the index and the holder of the first key held by another.
+const lockAllCommand = `for i = 1, #KEYS do
+    local holder = redis.call("GET", KEYS[i])
+    if holder and holder ~= ARGV[1] then
+        return {i, holder}
+    end
+end
+for i = 1, #KEYS do
+    redis.call("SET", KEYS[i], ARGV[1], "PX", ARGV[2])
+end
+return 1`
+
+var lockAllScript = red.NewScript(lockAllCommand)
+
+const (
+	minMultiBackoff = 10 * time.Millisecond
+	maxMultiBackoff = 500 * time.Millisecond
+)
+
+// A MultiLock is a lock over several keys, held with one token.
+//
+// The keys are always acquired in sorted order, so two processes locking
+// overlapping sets of keys can't deadlock each other by taking them in
+// opposite orders.
+type MultiLock struct {
+	locks []*RedisLock
+	clock Clock
+}
+
+// NewMultiLock returns a MultiLock over keys, duplicated keys are locked once.
+func NewMultiLock(redis *red.Client, keys []string, prefix string) *MultiLock {
+	sorted := make([]string, 0, len(keys))
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			sorted = append(sorted, prefix+key)
+		}
+	}
+	sort.Strings(sorted)
+
+	id := newToken()
+	ml := &MultiLock{
+		locks: make([]*RedisLock, len(sorted)),
+		clock: getClock(),
+	}
+	for i, key := range sorted {
+		ml.locks[i] = newWithID(redis, key, id)
+	}
+
+	return ml
+}
+
+// Acquire acquires all the keys in sorted order. If one of them is held by
+// others, the keys acquired so far are rolled back and false is returned.
+// An error is returned if the rollback failed, as the partial holds then
+// stay in place until they expire.
+func (ml *MultiLock) Acquire() (bool, error) {
+	for i, rl := range ml.locks {
+		ok, err := rl.Acquire()
+		if err != nil || !ok {
+			if _, rerr := ml.release(ml.locks[:i]); err == nil {
+				err = rerr
+			}
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// TryLockAll acquires all the keys in a single script, atomically: either
+// all of them are acquired or none is, so there is no partial hold to roll
+// back. The keys must be on the same node, i.e. share a hash tag on redis
+// cluster.
+func (ml *MultiLock) TryLockAll() (bool, error) {
+	prev := make([]State, len(ml.locks))
+	keys := make([]string, len(ml.locks))
+	for i, rl := range ml.locks {
+		state, err := rl.transition("acquire", Acquiring, Unlocked, Held, Lost, Released)
+		if err != nil {
+			for j := range ml.locks[:i] {
+				ml.locks[j].settle(Acquiring, prev[j])
+			}
+			return false, err
+		}
+		prev[i] = state
+		keys[i] = rl.key
+	}
+
+	if len(ml.locks) == 0 {
+		return true, nil
+	}
+	var taken []*RedisLock
+	for i, rl := range ml.locks {
+		took, err := rl.beginHold(0)
+		if err != nil {
+			releaseSlots(taken)
+			for j := range ml.locks {
+				ml.locks[j].settle(Acquiring, prev[j])
+			}
+			return false, err
+		} else if took {
+			taken = append(taken, ml.locks[i])
+		}
+	}
+
+	args := ml.locks[0].lockArgs.Load().([]interface{})
+	start := ml.clock.Now()
+	resp, err := lockAllScript.Run(tempContext, ml.locks[0].redis, keys, args[:2]...).Result()
+	ok := err == nil && resp == int64(1)
+	if reply, _ := resp.([]interface{}); len(reply) == 2 {
+		i, _ := reply[0].(int64)
+		if holder, _ := reply[1].(string); i > 0 && int(i) <= len(keys) {
+			emit(EventContended, keys[i-1], holder, ml.clock.Now().UnixNano()/1e6)
+		}
+	}
+	if !ok {
+		releaseSlots(taken)
+	}
+	for i, rl := range ml.locks {
+		rl.debugOp("acquire", start, ok, err)
+		if !ok {
+			rl.settle(Acquiring, prev[i])
+			continue
+		}
+		if prev[i] != Held {
+			rl.startHold(0)
+		} else {
+			// a re-acquired key is held for a full expire again.
+			atomic.StoreUint32(&rl.holdSeconds, 0)
+			rl.renewHold(rl.validity())
+		}
+		rl.settle(Acquiring, Held)
+	}
+
+	return ok, err
+}
+
+// TryLockTimeout retries acquiring all the keys within timeOutSeconds, with
+// an exponential backoff between attempts. Each failed attempt rolls back
+// its partial holds before backing off.
+func (ml *MultiLock) TryLockTimeout(timeOutSeconds float64) (bool, error) {
+	deadline := ml.clock.Now().Add(time.Duration(timeOutSeconds * float64(time.Second)))
+	backoff := minMultiBackoff
+	for {
+		if ok, err := ml.Acquire(); err == ErrAlreadyHeld {
+			return false, err
+		} else if ok {
+			return true, nil
+		}
+
+		remaining := deadline.Sub(ml.clock.Now())
+		if remaining <= 0 {
+			break
+		}
+
+		// full jitter, so that contending processes don't retry in lockstep.
+		sleep := time.Duration(rand.Int63n(int64(backoff)) + 1)
+		if sleep > remaining {
+			sleep = remaining
+		}
+		ml.clock.Sleep(sleep)
+		if backoff *= 2; backoff > maxMultiBackoff {
+			backoff = maxMultiBackoff
+		}
+	}
+
+	return false, errors.New(fmt.Sprintf("Cann't acquiring lock within %03fs", timeOutSeconds))
+}
+
+// Release releases all the keys, it returns false if any was not held.
+func (ml *MultiLock) Release() (bool, error) {
+	return ml.release(ml.locks)
+}
+
+// Extend extends all the keys in one round trip, it returns false if any
+// was not held.
+func (ml *MultiLock) Extend() (bool, error) {
+	held, err := ExtendAll(ml.locks...)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ok := range held {
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// SetClock sets the clock used for timeouts and expires of all the keys, it
+// must be called before the lock is used.
+func (ml *MultiLock) SetClock(clock Clock) {
+	ml.clock = clock
+	for _, rl := range ml.locks {
+		rl.SetClock(clock)
+	}
+}
+
+// SetExpire sets the expire of all the keys.
+func (ml *MultiLock) SetExpire(seconds int) {
+	for _, rl := range ml.locks {
+		rl.SetExpire(seconds)
+	}
+}
+
+func (ml *MultiLock) release(locks []*RedisLock) (bool, error) {
+	released := true
+	var lastErr error
+	for _, rl := range locks {
+		ok, err := rl.Release()
+		if err != nil {
+			lastErr = err
+		}
+		released = released && ok
+	}
+
+	return released && lastErr == nil, lastErr
+}
@@ -0,0 +1,182 @@
+package redislock
+
+import (
+	"errors"
+	red "github.com/go-redis/redis/v8"
+	"sync/atomic"
+)
+
+// ErrQuotaExceeded is returned when acquiring a lock of a namespace that
+// already holds MaxHeld locks.
+var ErrQuotaExceeded = errors.New("redislock: namespace quota exceeded")
+
+// ErrExpireTooLong is returned when acquiring or extending a lock whose
+// expire is over the MaxExpire of its namespace.
+var ErrExpireTooLong = errors.New("redislock: expire over the namespace maximum")
+
+// A NamespaceConfig configures a Namespace.
+type NamespaceConfig struct {
+	Name string
+	// DB is the redis logical DB of the namespace.
+	DB int
+	// Prefix is prepended to the keys of the namespace.
+	Prefix string
+	// Expire is the default expire in seconds of the locks, 0 keeps the
+	// default of New.
+	Expire int
+	// Label is the key reported to Metrics for all the locks of the
+	// namespace, empty reports their keys through the key grouper.
+	Label string
+	// MaxExpire caps the expire in seconds of the locks, including the
+	// expires derived from context deadlines, 0 for no cap. Longer expires
+	// are clamped to it unless RejectLongExpire is set, then acquires and
+	// extends fail with ErrExpireTooLong.
+	MaxExpire        int
+	RejectLongExpire bool
+	// MaxHeld is the most locks of the namespace this process may hold at
+	// a time, 0 for no limit. Acquiring more fails with ErrQuotaExceeded.
+	MaxHeld int
+}
+
+// A Namespace creates locks sharing a redis DB, a key prefix, a default
+// expire and a metrics label, so teams sharing a redis deployment can keep
+// their locks apart.
+type Namespace struct {
+	// held is the number of slots of MaxHeld taken, it's kept first for
+	// the alignment of its atomic accesses.
+	held   int64
+	config NamespaceConfig
+	redis  *red.Client
+}
+
+// NewNamespaces returns the namespaces by name, connected with c. The
+// namespaces on the same DB share one client.
+func NewNamespaces(c Config, namespaces ...NamespaceConfig) (map[string]*Namespace, error) {
+	clients := make(map[int]*red.Client)
+	result := make(map[string]*Namespace, len(namespaces))
+	for _, nc := range namespaces {
+		client, ok := clients[nc.DB]
+		if !ok {
+			dbConfig := c
+			dbConfig.DB = nc.DB
+			var err error
+			if client, err = NewClientFromConfig(dbConfig); err != nil {
+				for _, client := range clients {
+					_ = client.Close()
+				}
+				return nil, err
+			}
+			clients[nc.DB] = client
+		}
+
+		result[nc.Name] = &Namespace{
+			config: nc,
+			redis:  client,
+		}
+	}
+
+	return result, nil
+}
+
+// New returns a RedisLock on key in the namespace.
+func (n *Namespace) New(key string) *RedisLock {
+	rl := New(n.redis, key, n.config.Prefix)
+	rl.label = n.config.Label
+	rl.namespace = n
+	if n.config.MaxExpire > 0 {
+		rl.maxExpire = uint32(n.config.MaxExpire)
+		rl.rejectLongExpire = n.config.RejectLongExpire
+	}
+	if n.config.Expire > 0 {
+		rl.SetExpire(n.config.Expire)
+	} else {
+		rl.SetExpire(int(atomic.LoadUint32(&rl.seconds)))
+	}
+
+	return rl
+}
+
+// Name returns the name of the namespace.
+func (n *Namespace) Name() string {
+	return n.config.Name
+}
+
+// Held returns the number of locks of the namespace this process holds or
+// is acquiring. It's only counted when MaxHeld is set.
+func (n *Namespace) Held() int {
+	return int(atomic.LoadInt64(&n.held))
+}
+
+// Client returns the redis client of the namespace.
+func (n *Namespace) Client() *red.Client {
+	return n.redis
+}
+
+// reserveSlot takes a slot of the namespace quota for a hold of rl unless
+// it has one already. It returns whether it took a slot, and false if the
+// quota is exhausted. The slots of the holds left to expire are freed
+// before giving up.
+func (rl *RedisLock) reserveSlot() (took bool, ok bool) {
+	n := rl.namespace
+	if n == nil || n.config.MaxHeld <= 0 || atomic.LoadUint32(&rl.reserved) == 1 {
+		return false, true
+	}
+
+	swept := false
+	for {
+		held := atomic.LoadInt64(&n.held)
+		if held >= int64(n.config.MaxHeld) {
+			if !swept {
+				sweepExpired()
+				swept = true
+				continue
+			}
+			return false, false
+		} else if atomic.CompareAndSwapInt64(&n.held, held, held+1) {
+			atomic.StoreUint32(&rl.reserved, 1)
+			return true, true
+		}
+	}
+}
+
+// beginHold checks the expire of a hold of rl for seconds, 0 for the one
+// set by SetExpire, and takes a slot of the namespace quota for it. Every
+// acquire and extend goes through it before reaching redis, so that holds
+// whose slot was freed by expiring take one back. It returns whether it
+// took a slot, to give back with releaseSlot if the hold doesn't start.
+func (rl *RedisLock) beginHold(seconds uint32) (bool, error) {
+	if err := rl.checkExpire(seconds); err != nil {
+		return false, err
+	}
+	took, ok := rl.reserveSlot()
+	if !ok {
+		return false, ErrQuotaExceeded
+	}
+	return took, nil
+}
+
+// releaseSlot gives back the slot taken by reserveSlot, if any.
+func (rl *RedisLock) releaseSlot() {
+	if atomic.CompareAndSwapUint32(&rl.reserved, 1, 0) {
+		atomic.AddInt64(&rl.namespace.held, -1)
+	}
+}
+
+// releaseSlots gives back the slots taken for locks whose holds didn't start.
+func releaseSlots(locks []*RedisLock) {
+	for _, rl := range locks {
+		rl.releaseSlot()
+	}
+}
+
+// checkExpire rejects an expire over the cap when rejectLongExpire is set,
+// seconds is the expire of the hold, 0 for the one set by SetExpire.
+func (rl *RedisLock) checkExpire(seconds uint32) error {
+	if seconds == 0 {
+		seconds = atomic.LoadUint32(&rl.seconds)
+	}
+	if rl.rejectLongExpire && seconds > rl.maxExpire {
+		return ErrExpireTooLong
+	}
+	return nil
+}
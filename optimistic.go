@@ -0,0 +1,44 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	red "github.com/go-redis/redis/v8"
+)
+
+// ErrConflict is returned by UpdateOptimistic when the key kept changing.
+var ErrConflict = errors.New("redislock: optimistic update conflict")
+
+// UpdateOptimistic sets key to the value returned by fn from its current
+// value, only if the key didn't change meanwhile, without taking a lock.
+// On a concurrent change fn is called again with the new value, up to
+// attempts times before giving up with ErrConflict. The ttl of the key is
+// kept, which requires redis 6.0 or later.
+func UpdateOptimistic(ctx context.Context, redis *red.Client, key string, attempts int,
+	fn func(value string, exists bool) (string, error)) error {
+	update := func(tx *red.Tx) error {
+		value, err := tx.Get(ctx, key).Result()
+		if err != nil && err != red.Nil {
+			return err
+		}
+
+		value, err = fn(value, err == nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe red.Pipeliner) error {
+			pipe.Set(ctx, key, value, red.KeepTTL)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < attempts; i++ {
+		if err := redis.Watch(ctx, update, key); err != red.TxFailedErr {
+			return err
+		}
+	}
+
+	return ErrConflict
+}
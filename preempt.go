@@ -0,0 +1,219 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	red "github.com/go-redis/redis/v8"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// fencedLockCommand acquires KEYS[1] like lockCommand, and increments the
+	// fencing counter KEYS[2] for every new hold. It returns the new fencing
+	// token, 0 when re-entering, or the holder and its PTTL.
+	fencedLockCommand = `local holder = redis.call("GET", KEYS[1])
+if holder == ARGV[1] and ARGV[3] ~= "1" then
+    redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+    return 0
+elseif redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+    return redis.call("INCR", KEYS[2])
+else
+    return {holder, redis.call("PTTL", KEYS[1])}
+end`
+	// preemptCommand takes KEYS[1] over if it's free or still held by the
+	// preempted holder ARGV[3], tells the holder on the lost channel, and
+	// returns the new fencing token, or 0 if the lock changed hands.
+	preemptCommand = `local holder = redis.call("GET", KEYS[1])
+if holder and holder ~= ARGV[3] then
+    return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+if holder then
+    redis.call("PUBLISH", KEYS[1] .. ARGV[4], holder)
+end
+return redis.call("INCR", KEYS[2])`
+)
+
+const (
+	prioritySep          = "#"
+	fenceSuffix          = ":fence"
+	preemptChannelSuffix = ":preempt"
+)
+
+var (
+	fencedLockScript = red.NewScript(fencedLockCommand)
+	preemptScript    = red.NewScript(preemptCommand)
+)
+
+var (
+	// ErrNoPriority is returned by Preempt on a lock created without a
+	// priority.
+	ErrNoPriority = errors.New("redislock: lock without a priority")
+	// ErrPreempted is returned by DoWithAutoRefresh when the lock was
+	// preempted by a holder of higher priority.
+	ErrPreempted = errors.New("redislock: lock preempted")
+)
+
+// NewWithPriority returns a RedisLock like New with a priority, for strictly
+// prioritized systems: it can take the lock from holders of lower priority
+// with Preempt. The priority is carried by the value of the lock, holders
+// without one have priority 0.
+//
+// Every new hold of the lock also takes a fencing token, see Fence, from a
+// counter next to the key. On redis cluster the key must carry a hash tag,
+// as the counter key is derived from it.
+func NewWithPriority(redis *red.Client, key string, prefix string, priority int) *RedisLock {
+	rl := newWithID(redis, prefix+key, newToken()+prioritySep+strconv.Itoa(priority))
+	rl.priority = priority
+	rl.fenceKeys = []string{rl.key, rl.key + fenceSuffix}
+	return rl
+}
+
+// Fence returns the fencing token of the current hold of a lock created by
+// NewWithPriority, 0 for the other locks. The tokens of the successive holds
+// of a key only increase, so the stores written under the lock can reject
+// the writes carrying a lower token than one already seen, e.g. from a
+// preempted holder that didn't stop in time.
+func (rl *RedisLock) Fence() int64 {
+	return atomic.LoadInt64(&rl.fence)
+}
+
+// Preempt acquires the lock, preempting a holder of lower priority: the
+// holder is sent a preemption request, see WatchPreemption, and the lock is
+// taken over once grace elapsed unless the holder released it before. It
+// returns false if the lock is held with an equal or higher priority, or
+// changed hands meanwhile. The preempted holder finds out on its next
+// extend if it doesn't watch for requests.
+func (rl *RedisLock) Preempt(ctx context.Context, grace time.Duration) (bool, error) {
+	if rl.fenceKeys == nil {
+		return false, ErrNoPriority
+	} else if rl.mirrorKeys != nil {
+		return false, ErrMirrored
+	}
+
+	ok, holder, _, err := rl.acquire(ctx)
+	if err != nil || ok || holder == "" || priorityOf(holder) >= rl.priority {
+		return ok, err
+	}
+
+	deadline := rl.clock.Now().Add(grace)
+	request := strconv.FormatInt(deadline.UnixNano()/1e6, 10) + " " + holder
+	if err := rl.redis.Publish(ctx, rl.key+preemptChannelSuffix, request).Err(); err != nil {
+		return false, err
+	}
+
+	// give the holder until the deadline to release the lock.
+	for {
+		wait := deadline.Sub(rl.clock.Now())
+		if wait <= 0 {
+			return rl.takeOver(ctx, holder)
+		} else if wait > retryInterval {
+			wait = retryInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-rl.clock.After(wait):
+		}
+
+		ok, current, _, err := rl.acquire(ctx)
+		if err != nil || ok || (current != "" && current != holder) {
+			return ok, err
+		}
+	}
+}
+
+// takeOver sets the lock to rl if it's free or still held by holder.
+func (rl *RedisLock) takeOver(ctx context.Context, holder string) (bool, error) {
+	prev, err := rl.transition("preempt", Acquiring, Unlocked, Lost, Released)
+	if err != nil {
+		return false, err
+	}
+	took, err := rl.beginHold(0)
+	if err != nil {
+		rl.settle(Acquiring, prev)
+		return false, err
+	}
+
+	args := rl.lockArgs.Load().([]interface{})
+	start := rl.clock.Now()
+	fence, err := preemptScript.Run(ctx, rl.redis, rl.fenceKeys, args[0], args[1], holder, lostChannelSuffix).Int64()
+	rl.debugOp("preempt", start, err == nil && fence > 0, err)
+	if err != nil || fence == 0 {
+		if took {
+			rl.releaseSlot()
+		}
+		rl.settle(Acquiring, prev)
+		return false, err
+	}
+
+	atomic.StoreInt64(&rl.fence, fence)
+	rl.startHold(0)
+	rl.settle(Acquiring, Held)
+	return true, nil
+}
+
+// WatchPreemption makes the Guard listen for the preemption requests sent
+// to its lock by Preempt, and close Done as soon as one is received, so the
+// holder stops its work and releases the lock before the deadline of the
+// request, see PreemptDeadline. DoWithAutoRefresh watches the requests of
+// the locks created by NewWithPriority.
+func (g *Guard) WatchPreemption() {
+	sub := g.lock.redis.Subscribe(tempContext, g.lock.key+preemptChannelSuffix)
+	if _, err := sub.Receive(tempContext); err != nil {
+		_ = sub.Close()
+		return
+	}
+
+	go func() {
+		defer sub.Close()
+
+		messages := channel(sub)
+		for {
+			select {
+			case <-g.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				i := strings.Index(msg.Payload, " ")
+				if i < 0 || msg.Payload[i+1:] != g.lock.id {
+					continue
+				}
+				millis, _ := strconv.ParseInt(msg.Payload[:i], 10, 64)
+				atomic.StoreInt64(&g.preemptDeadline, millis*1e6)
+				g.stop()
+				return
+			}
+		}
+	}()
+}
+
+// PreemptDeadline returns the time the lock of the Guard is taken over at,
+// and false if it wasn't preempted.
+func (g *Guard) PreemptDeadline() (time.Time, bool) {
+	deadline := atomic.LoadInt64(&g.preemptDeadline)
+	if deadline == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, deadline), true
+}
+
+// priorityOf returns the priority carried by a lock value, 0 if none.
+func priorityOf(value string) int {
+	i := strings.LastIndex(value, prioritySep)
+	if i < 0 {
+		return 0
+	}
+
+	priority, err := strconv.Atoi(value[i+1:])
+	if err != nil {
+		return 0
+	}
+	return priority
+}
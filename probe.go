@@ -0,0 +1,44 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+	"time"
+)
+
+// StartProbe starts a background probe acquiring and releasing a canary lock
+// on key every interval until ctx is done, reporting the latency of each
+// round trip and its error through Metrics.ObserveProbe. The probe detects a
+// degraded lock path before user traffic suffers from it, key should be
+// dedicated to it.
+func StartProbe(ctx context.Context, redis *red.Client, key string, interval time.Duration) {
+	clock := getClock()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-clock.After(interval):
+				probe(ctx, redis, key)
+			}
+		}
+	}()
+}
+
+func probe(ctx context.Context, redis *red.Client, key string) {
+	rl := New(redis, key, "")
+	start := rl.clock.Now()
+	ok, err := rl.AcquireCtx(ctx)
+	if ok {
+		_, err = rl.ReleaseCtx(ctx)
+	} else if err == nil {
+		// the key is dedicated to the probe, so it's held by a stale probe.
+		err = ErrNotAcquired
+	}
+	if ctx.Err() != nil {
+		// stopped, not degraded.
+		return
+	}
+
+	getMetrics().ObserveProbe(rl.metricKey(), rl.clock.Now().Sub(start), err)
+}
@@ -0,0 +1,25 @@
+package redislock
+
+import "sync/atomic"
+
+var redactor atomic.Value // func(key string) string
+
+func init() {
+	SetRedactor(nil)
+}
+
+// SetRedactor sets the function transforming lock keys before they are
+// written to logs or to String and MarshalJSON output, e.g. to hash the user
+// ids embedded in keys. nil writes the keys as is.
+func SetRedactor(redact func(key string) string) {
+	if redact == nil {
+		redact = func(key string) string {
+			return key
+		}
+	}
+	redactor.Store(redact)
+}
+
+func redactKey(key string) string {
+	return redactor.Load().(func(string) string)(key)
+}
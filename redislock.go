@@ -7,35 +7,140 @@ import (
 	red "github.com/go-redis/redis/v8"
 	"math/rand"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 const (
-	lockCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	lockCommand = `local holder = redis.call("GET", KEYS[1])
+if holder == ARGV[1] and ARGV[3] ~= "1" then
     redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
     return "OK"
+elseif redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+    return "OK"
 else
-    return redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2])
+    return {holder, redis.call("PTTL", KEYS[1])}
 end`
 	delCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
     return redis.call("DEL", KEYS[1])
 else
     return 0
 end`
+	extendCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+else
+    return 0
+end`
+	extendAllCommand = `local result = {}
+for i = 1, #KEYS do
+    if redis.call("GET", KEYS[i]) == ARGV[2*i-1] then
+        result[i] = redis.call("PEXPIRE", KEYS[i], ARGV[2*i])
+    else
+        result[i] = 0
+    end
+end
+return result`
+	touchCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("SET", KEYS[1], ARGV[1], "XX", "KEEPTTL")
+else
+    return 0
+end`
 
 	letters         = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	randomLen       = 16
 	tolerance       = 500 // milliseconds
 	millisPerSecond = 1000
+	retryInterval   = 70 * time.Millisecond
+)
+
+// ErrAlreadyHeld is returned in strict mode when acquiring a lock that is
+// already held by the same RedisLock.
+var ErrAlreadyHeld = errors.New("redislock: lock already held")
+
+// ErrNotAcquired is returned when a lock is held by others.
+var ErrNotAcquired = errors.New("redislock: lock not acquired")
+
+// ErrMixedClients is returned by ExtendAll when the locks don't share a client.
+var ErrMixedClients = errors.New("redislock: locks use different redis clients")
+
+var (
+	lockScript      = red.NewScript(lockCommand)
+	delScript       = red.NewScript(delCommand)
+	extendScript    = red.NewScript(extendCommand)
+	extendAllScript = red.NewScript(extendAllCommand)
+	touchScript     = red.NewScript(touchCommand)
 )
 
 // A RedisLock is a redis lock.
 type RedisLock struct {
-	redis   *red.Client
-	seconds uint32
-	key     string
-	id      string
+	// acquiredAt is the unix nano time the lock was last acquired at, it's
+	// kept first for the alignment of its atomic accesses.
+	acquiredAt int64
+	// heldUntil is the unix nano time the hold expires at unless extended.
+	heldUntil int64
+	// fence is the fencing token of the current hold, see Fence.
+	fence int64
+	// deadlineMargin is added to the context deadline to get the expire
+	// when deadlineExpire is set.
+	deadlineMargin int64
+	// maxHold is the longest DoWithAutoRefresh keeps the lock, 0 for ever.
+	maxHold int64
+	// progressTimeout is the longest DoWithAutoRefresh refreshes the lock
+	// without a call to Guard.Progress, 0 for ever.
+	progressTimeout int64
+	onMaxHold       atomic.Value // func(key string)
+	// refreshFailure is applied by DoWithAutoRefresh when a refresh fails.
+	refreshFailure refreshFailure
+	redis          *red.Client
+	seconds        uint32
+	// holdSeconds is the expire of the current hold when it differs from
+	// seconds, e.g. derived from a context deadline, 0 otherwise.
+	holdSeconds uint32
+	strict      uint32
+	// recoverPanics is set to make DoWithAutoRefresh return panics as errors.
+	recoverPanics uint32
+	// deadlineExpire is set to derive the expire from context deadlines.
+	deadlineExpire uint32
+	state          int32
+	// tracked is set while the lock is counted in HeldLocks.
+	tracked uint32
+	// reserved is set while the lock takes a slot of its namespace quota.
+	reserved  uint32
+	namespace *Namespace
+	// maxExpire caps the expire in seconds, 0 for no cap. SetExpire clamps
+	// to it unless rejectLongExpire is set.
+	maxExpire        uint32
+	rejectLongExpire bool
+	key              string
+	id               string
+	label            string
+	// group tags the lock for ReleaseGroup.
+	group string
+	// token and metadata are the parts of the value of a lock created by
+	// NewWithMetadata, empty otherwise, the value is rebuilt from them with
+	// the acquisition time of each hold.
+	token    string
+	metadata string
+	// priority is the priority of a lock created by NewWithPriority, whose
+	// acquires go through fenceKeys, the key and its fencing counter.
+	priority  int
+	fenceKeys []string
+	// borrowed is set on the locks sharing the hold of a caller, see
+	// NewFromContext, their releases leave the key to the caller.
+	borrowed bool
+	// lenientRelease is set on the locks of NewRedisLock.
+	lenientRelease bool
+	clock          Clock
+	slowMu         sync.Mutex
+	slowTimer      Timer
+	// keys, lockArgs and idArgs are built once so that the hot path
+	// doesn't allocate them on every call.
+	keys []string
+	// mirrorKeys is the key also held while migrating, see SetMirror.
+	mirrorKeys []string
+	lockArgs   atomic.Value // []interface{}{id, ttl in milliseconds, strict}
+	idArgs     []interface{}
 }
 
 var tempContext = context.Background()
@@ -44,76 +149,409 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
-// NewRedisLock returns a RedisLock.
+// New returns a RedisLock on prefix+key.
 func New(redis *red.Client, key string, prefix string) *RedisLock {
-	return &RedisLock{
-		redis:   redis,
-		seconds: 3,
-		key:     prefix + key,
-		id:      randomStr(randomLen),
+	return newWithID(redis, prefix+key, newToken())
+}
+
+// NewRedisLock returns a RedisLock on key without a prefix, with the
+// signature of go-zero's constructor so its users can switch over. Like
+// go-zero, releasing a lock it doesn't hold returns false rather than
+// ErrInvalidState, so call sites releasing unconditionally keep working.
+func NewRedisLock(redis *red.Client, key string) *RedisLock {
+	rl := New(redis, key, "")
+	rl.lenientRelease = true
+	return rl
+}
+
+// NewWithToken returns a RedisLock like New with the given token, e.g. to
+// take over a lock whose token was handed over by another process.
+func NewWithToken(redis *red.Client, key string, prefix string, token string) *RedisLock {
+	return newWithID(redis, prefix+key, token)
+}
+
+func newWithID(redis *red.Client, key string, id string) *RedisLock {
+	rl := &RedisLock{
+		redis: redis,
+		key:   key,
+		id:    id,
+		clock: getClock(),
 	}
+	rl.keys = []string{rl.key}
+	rl.idArgs = []interface{}{rl.id}
+	rl.SetExpire(3)
+	return rl
 }
 
 // Acquire acquires the lock.
 func (rl *RedisLock) Acquire() (bool, error) {
-	seconds := atomic.LoadUint32(&rl.seconds)
-	resp, err := rl.redis.Eval(tempContext, lockCommand, []string{rl.key}, []string{
-		rl.id, strconv.Itoa(int(seconds)*millisPerSecond + tolerance),
-	}).Result()
+	ok, _, _, err := rl.acquire(tempContext)
+	return ok, err
+}
+
+// AcquireCtx acquires the lock with the given context.
+func (rl *RedisLock) AcquireCtx(ctx context.Context) (bool, error) {
+	ok, _, _, err := rl.acquire(ctx)
+	return ok, err
+}
+
+// AcquireWithHolder acquires the lock like Acquire, and on failure also
+// returns the token of the current holder, read atomically with the attempt.
+func (rl *RedisLock) AcquireWithHolder() (bool, string, error) {
+	ok, holder, _, err := rl.acquire(tempContext)
+	return ok, holder, err
+}
+
+// acquire returns on failure the token of the holder and the time left
+// until its key expires.
+func (rl *RedisLock) acquire(ctx context.Context) (bool, string, time.Duration, error) {
+	return rl.acquireFor(ctx, 0)
+}
+
+// acquireFor acquires the lock for a hold of seconds, 0 for the expire set
+// by SetExpire.
+func (rl *RedisLock) acquireFor(ctx context.Context, seconds uint32) (bool, string, time.Duration, error) {
+	prev, err := rl.transition("acquire", Acquiring, Unlocked, Held, Lost, Released)
+	if err != nil {
+		return false, "", 0, err
+	}
+
+	took, err := rl.beginHold(seconds)
+	if err != nil {
+		rl.settle(Acquiring, prev)
+		return false, "", 0, err
+	} else if prev != Held {
+		rl.stampValue()
+	}
+
+	start := rl.clock.Now()
+	ok, holder, holderTTL, err := rl.evalAcquire(ctx, seconds)
+	if ok && rl.mirrorKeys != nil {
+		ok, err = rl.lockMirror(ctx, seconds)
+	}
+	rl.debugOp("acquire", start, ok, err)
+	switch {
+	case ok:
+		if prev != Held {
+			rl.startHold(seconds)
+		} else {
+			atomic.StoreUint32(&rl.holdSeconds, seconds)
+			rl.renewHold(rl.validity())
+		}
+		rl.settle(Acquiring, Held)
+	case prev == Held && err == nil:
+		// re-acquiring failed, it's held by others now.
+		rl.settle(Acquiring, Lost)
+		emit(EventContended, rl.key, holder, rl.clock.Now().UnixNano()/1e6)
+	default:
+		if holder != "" && err == nil {
+			emit(EventContended, rl.key, holder, rl.clock.Now().UnixNano()/1e6)
+		}
+		if took {
+			rl.releaseSlot()
+		}
+		rl.settle(Acquiring, prev)
+	}
+
+	return ok, holder, holderTTL, err
+}
+
+func (rl *RedisLock) evalAcquire(ctx context.Context, seconds uint32) (bool, string, time.Duration, error) {
+	script, keys := lockScript, rl.keys
+	if rl.fenceKeys != nil {
+		script, keys = fencedLockScript, rl.fenceKeys
+	}
+	resp, err := script.Run(ctx, rl.redis, keys, rl.acquireArgs(seconds)...).Result()
 
 	if err == red.Nil {
-		return false, nil
+		return false, "", 0, nil
 	} else if err != nil {
-		_ = fmt.Errorf("error on acquiring lock for %s, %s", rl.key, err.Error())
+		return false, "", 0, err
+	}
+
+	switch reply := resp.(type) {
+	case string:
+		return reply == "OK", "", 0, nil
+	case int64:
+		// a fencing token, 0 when re-entering.
+		if reply > 0 {
+			atomic.StoreInt64(&rl.fence, reply)
+		}
+		return true, "", 0, nil
+	case []interface{}:
+		if len(reply) > 0 {
+			holder, _ := reply[0].(string)
+			var ttl time.Duration
+			if len(reply) > 1 {
+				pttl, _ := reply[1].(int64)
+				if pttl > 0 {
+					ttl = time.Duration(pttl) * time.Millisecond
+				}
+			}
+			if holder == rl.id {
+				return false, holder, ttl, ErrAlreadyHeld
+			}
+			return false, holder, ttl, nil
+		}
+	}
+
+	return false, "", 0, nil
+}
+
+func (rl *RedisLock) TryLockTimeout(timeOutSeconds float64) (bool, error) {
+	result, err := rl.TryLockTimeoutWithResult(timeOutSeconds)
+	return result.Acquired, err
+}
+
+// Release releases the lock.
+func (rl *RedisLock) Release() (bool, error) {
+	return rl.ReleaseCtx(tempContext)
+}
+
+// ReleaseCtx releases the lock with the given context.
+func (rl *RedisLock) ReleaseCtx(ctx context.Context) (bool, error) {
+	prev, err := rl.transition("release", Released, Held, Extending, Lost)
+	if err != nil {
+		if rl.lenientRelease {
+			return false, nil
+		}
+		return false, err
+	} else if rl.borrowed {
+		rl.unwatchSlow()
+		rl.untrack()
+		return true, nil
+	}
+
+	start := rl.clock.Now()
+	resp, err := delScript.Run(ctx, rl.redis, rl.keys, rl.idArgs...).Result()
+	rl.debugOp("release", start, err == nil && resp == int64(1), err)
+	if err == nil && rl.mirrorKeys != nil {
+		_, _ = delScript.Run(ctx, rl.redis, rl.mirrorKeys, rl.idArgs...).Result()
+	}
+	if err != nil {
+		if prev == Extending {
+			prev = Held
+		}
+		rl.settle(Released, prev)
 		return false, err
-	} else if resp == nil {
+	}
+
+	rl.unwatchSlow()
+	rl.untrack()
+
+	reply, ok := resp.(int64)
+	if !ok || reply != 1 {
 		return false, nil
 	}
 
-	reply, ok := resp.(string)
-	if ok && reply == "OK" {
-		return true, nil
+	rl.audit(AuditRelease)
+	getMetrics().ObserveHoldTime(rl.metricKey(), rl.clock.Now().Sub(time.Unix(0, atomic.LoadInt64(&rl.acquiredAt))))
+	return true, nil
+}
+
+// Extend resets the expire of the lock if it's still held by rl.
+func (rl *RedisLock) Extend() (bool, error) {
+	return rl.extend(tempContext)
+}
+
+// ExtendCtx extends the lock like Extend with the given context.
+func (rl *RedisLock) ExtendCtx(ctx context.Context) (bool, error) {
+	return rl.extend(ctx)
+}
+
+func (rl *RedisLock) extend(ctx context.Context) (bool, error) {
+	if _, err := rl.transition("extend", Extending, Held); err != nil {
+		return false, err
+	}
+	took, err := rl.beginHold(atomic.LoadUint32(&rl.holdSeconds))
+	if err != nil {
+		rl.settle(Extending, Held)
+		return false, err
 	}
 
-	_ = fmt.Errorf("unknown reply when acquiring lock for %s: %v", rl.key, resp)
-	return false, nil
+	start := rl.clock.Now()
+	resp, err := extendScript.Run(ctx, rl.redis, rl.keys, rl.holdArgs()...).Result()
+	if err == nil && resp == int64(1) && rl.mirrorKeys != nil {
+		resp, err = extendScript.Run(ctx, rl.redis, rl.mirrorKeys, rl.holdArgs()...).Result()
+	}
+	rl.debugOp("extend", start, err == nil && resp == int64(1), err)
+	if err != nil {
+		if took {
+			rl.releaseSlot()
+		}
+		rl.settle(Extending, Held)
+		return false, err
+	}
+
+	if reply, ok := resp.(int64); !ok || reply != 1 {
+		rl.settle(Extending, Lost)
+		return false, nil
+	}
+
+	rl.renewHold(rl.validity())
+	rl.settle(Extending, Held)
+	rl.audit(AuditExtend)
+	return true, nil
 }
 
-func (rl *RedisLock) TryLockTimeout(timeOutSeconds float64) (bool, error) {
-	startTime := time.Now()
-	for {
-		if elapseTime := time.Since(startTime).Seconds(); elapseTime < timeOutSeconds {
-			if ok, err := rl.Acquire(); !ok || err != nil {
-				fmt.Printf("key:%s, id:%s Locked, retry %03f\n", rl.key, rl.id, elapseTime)
-			} else {
-				return true, nil
-			}
-		} else {
+// ExtendAll extends all the locks in a single round trip, reporting for each
+// lock whether it was still held. The locks must share the same redis client,
+// and on redis cluster their keys, mirrors included, must hash to the same
+// slot.
+func ExtendAll(locks ...*RedisLock) ([]bool, error) {
+	if len(locks) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(locks))
+	args := make([]interface{}, 0, 2*len(locks))
+	for _, rl := range locks {
+		if rl.redis != locks[0].redis {
+			return nil, ErrMixedClients
+		} else if state := rl.State(); state != Held {
+			return nil, fmt.Errorf("%w: cannot extend a %s lock", ErrInvalidState, state)
+		}
+		keys = append(keys, rl.key)
+		args = append(args, rl.holdArgs()...)
+	}
+	var taken []*RedisLock
+	for _, rl := range locks {
+		took, err := rl.beginHold(atomic.LoadUint32(&rl.holdSeconds))
+		if err != nil {
+			releaseSlots(taken)
+			return nil, err
+		} else if took {
+			taken = append(taken, rl)
+		}
+	}
+	// the mirrors go after the locks, owners maps them back to their lock.
+	var owners []int
+	for i, rl := range locks {
+		if rl.mirrorKeys != nil {
+			keys = append(keys, rl.mirrorKeys[0])
+			args = append(args, rl.holdArgs()...)
+			owners = append(owners, i)
+		}
+	}
+
+	resp, err := extendAllScript.Run(tempContext, locks[0].redis, keys, args...).Result()
+	if err != nil {
+		releaseSlots(taken)
+		return nil, err
+	}
+
+	replies, _ := resp.([]interface{})
+	held := make([]bool, len(locks))
+	for i, reply := range replies {
+		n, _ := reply.(int64)
+		if i < len(held) {
+			held[i] = n == 1
+		} else if j := i - len(held); j < len(owners) && n != 1 {
+			held[owners[j]] = false
+		}
+	}
+	for i, rl := range locks {
+		if i >= len(replies) {
 			break
+		} else if held[i] {
+			rl.renewHold(rl.validity())
+			rl.track()
+		} else {
+			rl.settle(Held, Lost)
 		}
-		time.Sleep(70 * time.Millisecond)
 	}
-	return false, errors.New(fmt.Sprintf("Cann't acquiring lock within %03fs", timeOutSeconds))
+
+	return held, nil
 }
 
-// Release releases the lock.
-func (rl *RedisLock) Release() (bool, error) {
-	resp, err := rl.redis.Eval(tempContext, delCommand, []string{rl.key}, []string{rl.id}).Result()
+// Touch re-asserts the ownership of the lock without touching its ttl.
+// It requires redis 6.0 or later for KEEPTTL.
+func (rl *RedisLock) Touch() (bool, error) {
+	if state := rl.State(); state != Held {
+		return false, fmt.Errorf("%w: cannot touch a %s lock", ErrInvalidState, state)
+	}
+
+	resp, err := touchScript.Run(tempContext, rl.redis, rl.keys, rl.idArgs...).Result()
+	if reply, ok := resp.(string); err == nil && ok && reply == "OK" && rl.mirrorKeys != nil {
+		resp, err = touchScript.Run(tempContext, rl.redis, rl.mirrorKeys, rl.idArgs...).Result()
+	}
 	if err != nil {
 		return false, err
 	}
 
-	reply, ok := resp.(int64)
-	if !ok {
+	if reply, ok := resp.(string); !ok || reply != "OK" {
+		rl.settle(Held, Lost)
 		return false, nil
 	}
 
-	return reply == 1, nil
+	return true, nil
+}
+
+// Token returns the token identifying the holder of the lock.
+func (rl *RedisLock) Token() string {
+	return rl.id
+}
+
+// SetClock sets the clock used for timeouts and expires, it must be called
+// before the lock is used.
+func (rl *RedisLock) SetClock(clock Clock) {
+	rl.clock = clock
 }
 
-// SetExpire sets the expire.
+// SetExpire sets the expire. It's clamped to the MaxExpire of the namespace
+// of the lock, if any.
 func (rl *RedisLock) SetExpire(seconds int) {
+	if limit := int(rl.maxExpire); limit > 0 && seconds > limit && !rl.rejectLongExpire {
+		seconds = limit
+	}
 	atomic.StoreUint32(&rl.seconds, uint32(seconds))
+	rl.buildLockArgs()
+}
+
+// SetStrict sets whether the lock is non-reentrant. In strict mode acquiring
+// a lock the RedisLock already holds fails with ErrAlreadyHeld instead of
+// silently resetting its ttl.
+func (rl *RedisLock) SetStrict(strict bool) {
+	var v uint32
+	if strict {
+		v = 1
+	}
+	atomic.StoreUint32(&rl.strict, v)
+	rl.buildLockArgs()
+}
+
+// buildLockArgs precomputes the acquire arguments, Acquire only loads them.
+func (rl *RedisLock) buildLockArgs() {
+	seconds := atomic.LoadUint32(&rl.seconds)
+	strict := atomic.LoadUint32(&rl.strict)
+	rl.lockArgs.Store([]interface{}{
+		rl.id,
+		expireArg(seconds),
+		strconv.Itoa(int(strict)),
+	})
+}
+
+// acquireArgs returns the acquire arguments for a hold of seconds, 0 for
+// the expire set by SetExpire.
+func (rl *RedisLock) acquireArgs(seconds uint32) []interface{} {
+	args := rl.lockArgs.Load().([]interface{})
+	if seconds > 0 {
+		args = []interface{}{rl.id, expireArg(seconds), args[2]}
+	}
+	return args
+}
+
+// holdArgs returns the extend arguments of the current hold.
+func (rl *RedisLock) holdArgs() []interface{} {
+	if seconds := atomic.LoadUint32(&rl.holdSeconds); seconds > 0 {
+		return []interface{}{rl.id, expireArg(seconds)}
+	}
+	return rl.lockArgs.Load().([]interface{})[:2]
+}
+
+// expireArg returns the ttl argument in milliseconds of an expire.
+func expireArg(seconds uint32) string {
+	return strconv.Itoa(int(seconds)*millisPerSecond + tolerance)
 }
 
 func randomStr(n int) string {
@@ -122,4 +560,4 @@ func randomStr(n int) string {
 		b[i] = letters[rand.Intn(len(letters))]
 	}
 	return string(b)
-}
\ No newline at end of file
+}
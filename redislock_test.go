@@ -0,0 +1,289 @@
+package redislock
+
+import (
+	"errors"
+	red "github.com/go-redis/redis/v8"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// benchClient connects to the redis server at REDIS_ADDR, the benchmarks
+// are skipped without one.
+func benchClient(b *testing.B) *red.Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		b.Skip("REDIS_ADDR is not set")
+	}
+
+	client := red.NewClient(&red.Options{Addr: addr})
+	b.Cleanup(func() {
+		_ = client.Close()
+	})
+	if err := client.Ping(tempContext).Err(); err != nil {
+		b.Fatal(err)
+	}
+	return client
+}
+
+func BenchmarkAcquire(b *testing.B) {
+	client := benchClient(b)
+	rl := New(client, "acquire", "redislock:bench:")
+	b.Cleanup(func() {
+		_, _ = rl.Release()
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if ok, err := rl.Acquire(); err != nil || !ok {
+			b.Fatalf("acquire: %t, %v", ok, err)
+		}
+	}
+}
+
+func BenchmarkRelease(b *testing.B) {
+	client := benchClient(b)
+	rl := New(client, "release", "redislock:bench:")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if ok, err := rl.Acquire(); err != nil || !ok {
+			b.Fatalf("acquire: %t, %v", ok, err)
+		}
+		b.StartTimer()
+
+		if ok, err := rl.Release(); err != nil || !ok {
+			b.Fatalf("release: %t, %v", ok, err)
+		}
+	}
+}
+
+// conformanceServers are the servers the scripts are checked against, each
+// is skipped unless its address is set. info is the field of INFO server
+// only that server reports, so a wrong address fails rather than passes.
+var conformanceServers = []struct {
+	name string
+	env  string
+	info string
+}{
+	{name: "redis", env: "REDIS_ADDR"},
+	{name: "valkey", env: "VALKEY_ADDR", info: "server_name:valkey"},
+	{name: "dragonfly", env: "DRAGONFLY_ADDR", info: "dragonfly_version:"},
+}
+
+var conformanceTests = []struct {
+	name string
+	test func(t *testing.T, client *red.Client, prefix string)
+}{
+	{"lock", testLockConformance},
+	{"multi", testMultiConformance},
+	{"session", testSessionConformance},
+	{"hash", testHashConformance},
+	{"migrate", testMigrateConformance},
+	{"force", testForceConformance},
+}
+
+// TestConformance runs the scripts of the locks against Redis, Valkey and
+// Dragonfly, at REDIS_ADDR, VALKEY_ADDR and DRAGONFLY_ADDR.
+func TestConformance(t *testing.T) {
+	for _, server := range conformanceServers {
+		server := server
+		t.Run(server.name, func(t *testing.T) {
+			addr := os.Getenv(server.env)
+			if addr == "" {
+				t.Skip(server.env + " is not set")
+			}
+
+			client := red.NewClient(&red.Options{Addr: addr})
+			t.Cleanup(func() {
+				_ = client.Close()
+			})
+			if server.info != "" {
+				info, err := client.Info(tempContext, "server").Result()
+				if err != nil {
+					t.Fatal(err)
+				} else if !strings.Contains(info, server.info) {
+					t.Fatalf("%s is not %s", addr, server.name)
+				}
+			}
+
+			for _, ct := range conformanceTests {
+				ct := ct
+				t.Run(ct.name, func(t *testing.T) {
+					prefix := "redislock:conformance:" + ct.name + ":"
+					t.Cleanup(func() {
+						deleteKeys(client, prefix)
+					})
+					ct.test(t, client, prefix)
+				})
+			}
+		})
+	}
+}
+
+func deleteKeys(client *red.Client, prefix string) {
+	iter := client.Scan(tempContext, 0, escapeGlob(prefix)+"*", 0).Iterator()
+	for iter.Next(tempContext) {
+		client.Del(tempContext, iter.Val())
+	}
+}
+
+// expect fails t unless ok is want and err is nil.
+func expect(t *testing.T, op string, ok bool, err error, want bool) {
+	t.Helper()
+	if err != nil || ok != want {
+		t.Fatalf("%s: %t, %v, want %t", op, ok, err, want)
+	}
+}
+
+func testLockConformance(t *testing.T, client *red.Client, prefix string) {
+	rl := New(client, "lock", prefix)
+	other := New(client, "lock", prefix)
+
+	ok, err := rl.Acquire()
+	expect(t, "acquire", ok, err, true)
+	ok, holder, err := other.AcquireWithHolder()
+	expect(t, "contended acquire", ok, err, false)
+	if holder != rl.Token() {
+		t.Fatalf("holder %q, want %q", holder, rl.Token())
+	}
+	ok, err = rl.Acquire()
+	expect(t, "re-acquire", ok, err, true)
+	ok, err = rl.Extend()
+	expect(t, "extend", ok, err, true)
+	ok, err = rl.Touch()
+	expect(t, "touch", ok, err, true)
+	ok, err = rl.ExtendIfBelow(time.Minute, 5*time.Second)
+	expect(t, "extend if below", ok, err, true)
+	if validity, err := rl.Validity(tempContext); err != nil || validity <= 3*time.Second {
+		t.Fatalf("validity: %s, %v", validity, err)
+	}
+	held, err := ExtendAll(rl)
+	expect(t, "extend all", len(held) == 1 && held[0], err, true)
+	if info, err := other.HolderInfo(tempContext); err != nil || info.Token != rl.Token() {
+		t.Fatalf("holder info: %+v, %v", info, err)
+	}
+
+	ok, err = other.Release()
+	if !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("foreign release: %t, %v", ok, err)
+	}
+	ok, err = rl.Release()
+	expect(t, "release", ok, err, true)
+	ok, err = other.Acquire()
+	expect(t, "acquire released", ok, err, true)
+
+	stealer := New(client, "lock", prefix)
+	ok, err = stealer.Steal(0)
+	expect(t, "steal", ok, err, true)
+	ok, err = other.Extend()
+	expect(t, "extend stolen", ok, err, false)
+	_, _ = stealer.Release()
+}
+
+func testMultiConformance(t *testing.T, client *red.Client, prefix string) {
+	ml := NewMultiLock(client, []string{"a", "b"}, prefix)
+	ok, err := ml.TryLockAll()
+	expect(t, "lock all", ok, err, true)
+	ok, err = NewMultiLock(client, []string{"b", "c"}, prefix).TryLockAll()
+	expect(t, "contended lock all", ok, err, false)
+	ok, err = ml.Extend()
+	expect(t, "extend all", ok, err, true)
+	ok, err = ml.Release()
+	expect(t, "release all", ok, err, true)
+
+	rl := New(client, "intent", prefix)
+	ok, err = rl.Intend(tempContext)
+	expect(t, "intend", ok, err, true)
+	ok, err = rl.Confirm(tempContext)
+	expect(t, "confirm", ok, err, true)
+	ok, err = rl.Release()
+	expect(t, "release confirmed", ok, err, true)
+}
+
+func testSessionConformance(t *testing.T, client *red.Client, prefix string) {
+	s := NewSession(client, prefix)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	other := NewSession(client, prefix)
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	ok, err := s.NewLock("lock").Acquire()
+	expect(t, "acquire", ok, err, true)
+	ok, err = other.NewLock("lock").Acquire()
+	expect(t, "contended acquire", ok, err, false)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = other.NewLock("lock").Acquire()
+	expect(t, "acquire after close", ok, err, true)
+}
+
+func testHashConformance(t *testing.T, client *red.Client, prefix string) {
+	hl := NewHashLock(client, "lock", prefix, 4)
+	other := NewHashLock(client, "lock", prefix, 4)
+
+	ok, err := hl.Acquire()
+	expect(t, "acquire", ok, err, true)
+	ok, err = other.Acquire()
+	expect(t, "contended acquire", ok, err, false)
+	ok, err = hl.Extend()
+	expect(t, "extend", ok, err, true)
+	ok, err = hl.Release()
+	expect(t, "release", ok, err, true)
+	ok, err = other.Acquire()
+	expect(t, "acquire released", ok, err, true)
+	_, _ = other.Release()
+}
+
+func testMigrateConformance(t *testing.T, client *red.Client, prefix string) {
+	rl := New(client, "lock", prefix+"old:")
+	ok, err := rl.Acquire()
+	expect(t, "acquire", ok, err, true)
+	defer rl.Release()
+
+	n, err := Migrate(tempContext, client, prefix+"old:", prefix+"new:")
+	if err != nil || n != 1 {
+		t.Fatalf("migrate: %d, %v", n, err)
+	}
+	if value, err := client.Get(tempContext, prefix+"new:lock").Result(); err != nil || value != rl.Token() {
+		t.Fatalf("migrated value: %q, %v", value, err)
+	}
+	if pttl, err := client.PTTL(tempContext, prefix+"new:lock").Result(); err != nil || pttl <= 0 {
+		t.Fatalf("migrated ttl: %s, %v", pttl, err)
+	}
+	// the copy is already there.
+	if n, err := Migrate(tempContext, client, prefix+"old:", prefix+"new:"); err != nil || n != 0 {
+		t.Fatalf("migrate again: %d, %v", n, err)
+	}
+}
+
+func testForceConformance(t *testing.T, client *red.Client, prefix string) {
+	rl := New(client, "lock", prefix)
+	ok, err := rl.Acquire()
+	expect(t, "acquire", ok, err, true)
+	hl := NewHashLock(client, "lock", prefix+"hash:", 1)
+	ok, err = hl.Acquire()
+	expect(t, "acquire hash", ok, err, true)
+
+	keys, err := ForceReleaseByPattern(tempContext, client, escapeGlob(prefix)+"*", true)
+	if err != nil || len(keys) != 1 || keys[0] != prefix+"lock" {
+		t.Fatalf("dry run: %v, %v", keys, err)
+	}
+	keys, err = ForceReleaseByPattern(tempContext, client, escapeGlob(prefix)+"*", false)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("force release: %v, %v", keys, err)
+	}
+	ok, err = rl.Extend()
+	expect(t, "extend released", ok, err, false)
+	ok, err = hl.Extend()
+	expect(t, "extend hash", ok, err, true)
+}
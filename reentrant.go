@@ -0,0 +1,143 @@
+package redislock
+
+import (
+	red "github.com/go-redis/redis/v8"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	reentrantLockCommand = `if redis.call("EXISTS", KEYS[1]) == 0 or redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+    redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+    redis.call("PEXPIRE", KEYS[1], ARGV[2])
+    return "OK"
+end
+return false`
+	reentrantDelCommand = `if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+    return 0
+end
+if redis.call("HINCRBY", KEYS[1], ARGV[1], -1) > 0 then
+    redis.call("PEXPIRE", KEYS[1], ARGV[2])
+else
+    redis.call("DEL", KEYS[1])
+    if ARGV[3] ~= "" then
+        redis.call("PUBLISH", ARGV[3], 0)
+    end
+end
+return 1`
+	reentrantExtendCommand = `if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+    return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`
+)
+
+var (
+	reentrantLockScript   = red.NewScript(reentrantLockCommand)
+	reentrantDelScript    = red.NewScript(reentrantDelCommand)
+	reentrantExtendScript = red.NewScript(reentrantExtendCommand)
+)
+
+// A ReentrantLock is a redis lock that counts nested acquires on the server.
+// The lock is stored as a hash of token to hold count, the same layout
+// Redisson uses for RLock, and is only freed when every acquire has been
+// matched by a release.
+type ReentrantLock struct {
+	redis   *red.Client
+	seconds uint32
+	key     string
+	id      string
+	keys    []string
+	// channel is notified on the last release, for Redisson waiters.
+	channel string
+	args    atomic.Value // []interface{}{id, ttl in milliseconds, channel}
+}
+
+// NewReentrant returns a ReentrantLock.
+func NewReentrant(redis *red.Client, key string, prefix string) *ReentrantLock {
+	rl := &ReentrantLock{
+		redis: redis,
+		key:   prefix + key,
+		id:    newToken(),
+	}
+	rl.keys = []string{rl.key}
+	rl.SetExpire(3)
+	return rl
+}
+
+// NewRedissonLock returns a ReentrantLock interoperating with the RLock of
+// Redisson clients on the lock name, so Go and Java services can contend on
+// the same locks. clientID and threadID make up the Redisson holder field,
+// i.e. the id of the Redisson connection manager and the id of the thread,
+// and the last release wakes the Redisson waiters on the lock channel.
+func NewRedissonLock(redis *red.Client, name string, clientID string, threadID int64) *ReentrantLock {
+	channel := "redisson_lock__channel:"
+	if strings.Contains(name, "{") {
+		channel += name
+	} else {
+		channel += "{" + name + "}"
+	}
+
+	rl := &ReentrantLock{
+		redis:   redis,
+		key:     name,
+		id:      clientID + ":" + strconv.FormatInt(threadID, 10),
+		keys:    []string{name},
+		channel: channel,
+	}
+	// the default lease of the Redisson lock watchdog.
+	rl.SetExpire(30)
+	return rl
+}
+
+// Acquire acquires the lock, or adds a hold if it's already held by rl.
+func (rl *ReentrantLock) Acquire() (bool, error) {
+	args := rl.args.Load().([]interface{})
+	resp, err := reentrantLockScript.Run(tempContext, rl.redis, rl.keys, args...).Result()
+	if err == red.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	reply, ok := resp.(string)
+	return ok && reply == "OK", nil
+}
+
+// Release drops one hold of the lock, the key is deleted with the last one.
+func (rl *ReentrantLock) Release() (bool, error) {
+	args := rl.args.Load().([]interface{})
+	resp, err := reentrantDelScript.Run(tempContext, rl.redis, rl.keys, args...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	reply, ok := resp.(int64)
+	if !ok {
+		return false, nil
+	}
+
+	return reply == 1, nil
+}
+
+// Extend resets the expire of the lock if it's held by rl.
+func (rl *ReentrantLock) Extend() (bool, error) {
+	args := rl.args.Load().([]interface{})
+	resp, err := reentrantExtendScript.Run(tempContext, rl.redis, rl.keys, args...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	reply, ok := resp.(int64)
+	if !ok {
+		return false, nil
+	}
+
+	return reply == 1, nil
+}
+
+// SetExpire sets the expire.
+func (rl *ReentrantLock) SetExpire(seconds int) {
+	atomic.StoreUint32(&rl.seconds, uint32(seconds))
+	rl.args.Store([]interface{}{rl.id, strconv.Itoa(seconds*millisPerSecond + tolerance), rl.channel})
+}
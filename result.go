@@ -0,0 +1,98 @@
+package redislock
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// An AcquireResult describes the outcome of acquiring a lock.
+type AcquireResult struct {
+	// Acquired reports whether the lock was acquired.
+	Acquired bool
+	// Token is the token of the acquired lock.
+	Token string
+	// Holder is the token of the current holder if the lock wasn't acquired.
+	Holder string
+	// HolderTTL is the time left until the key of the holder expires if
+	// the lock wasn't acquired, so waiters can sleep until then.
+	HolderTTL time.Duration
+	// Validity is how long the lock is still held for, counted from the
+	// end of the acquiring round trip.
+	Validity time.Duration
+	// Attempts is the number of acquiring attempts made.
+	Attempts int
+	// Wait is the total time spent acquiring.
+	Wait time.Duration
+}
+
+// AcquireWithResult acquires the lock like Acquire and describes the outcome.
+func (rl *RedisLock) AcquireWithResult() (AcquireResult, error) {
+	start := rl.clock.Now()
+	ok, holder, holderTTL, err := rl.acquire(tempContext)
+	result := AcquireResult{
+		Acquired:  ok,
+		Holder:    holder,
+		HolderTTL: holderTTL,
+		Attempts:  1,
+		Wait:      rl.clock.Now().Sub(start),
+	}
+	if ok {
+		result.Token = rl.id
+		result.Validity = rl.validity() - result.Wait
+	}
+
+	return result, err
+}
+
+// TryLockTimeoutWithResult retries acquiring the lock like TryLockTimeout and
+// describes the outcome, including the attempts made and the time waited.
+func (rl *RedisLock) TryLockTimeoutWithResult(timeOutSeconds float64) (result AcquireResult, err error) {
+	defer func() {
+		getMetrics().ObserveWaitTime(rl.metricKey(), result.Wait, result.Acquired)
+	}()
+
+	startTime := rl.clock.Now()
+	var starved bool
+	for {
+		if elapseTime := rl.clock.Now().Sub(startTime).Seconds(); elapseTime < timeOutSeconds {
+			attempt, err := rl.AcquireWithResult()
+			result.Attempts++
+			result.Holder = attempt.Holder
+			result.HolderTTL = attempt.HolderTTL
+			if err == ErrAlreadyHeld || err == ErrQuotaExceeded || err == ErrExpireTooLong || errors.Is(err, ErrInvalidState) {
+				result.Wait = rl.clock.Now().Sub(startTime)
+				return result, err
+			} else if !attempt.Acquired || err != nil {
+				if debugEnabled() {
+					fmt.Printf("key:%s, id:%s Locked, retry %03f\n", redactKey(rl.key), maskToken(rl.id), elapseTime)
+				}
+				if !starved {
+					starved = rl.reportStarvation(rl.clock.Now().Sub(startTime), attempt.Holder)
+				}
+			} else {
+				attempt.Attempts = result.Attempts
+				attempt.Wait = rl.clock.Now().Sub(startTime)
+				return attempt, nil
+			}
+		} else {
+			break
+		}
+		rl.clock.Sleep(retryInterval)
+	}
+
+	result.Wait = rl.clock.Now().Sub(startTime)
+	getMetrics().IncError(rl.metricKey(), ErrorTimeout)
+	return result, errors.New(fmt.Sprintf("Cann't acquiring lock within %03fs", timeOutSeconds))
+}
+
+// validity is how long the lock is held after an acquire or extend, the
+// tolerance on the server side is not counted.
+func (rl *RedisLock) validity() time.Duration {
+	seconds := atomic.LoadUint32(&rl.holdSeconds)
+	if seconds == 0 {
+		seconds = atomic.LoadUint32(&rl.seconds)
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,54 @@
+package redislock
+
+import (
+	"context"
+	red "github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+// RunOncePer runs fn at most once per period across all the processes calling
+// it with the same name, e.g. to dedup a cron task scheduled on every
+// instance. The periods are aligned to the unix epoch.
+//
+// It returns whether fn ran in this call. If fn fails, no marker is written
+// and a later call within the same period runs it again.
+func RunOncePer(ctx context.Context, redis *red.Client, name string, period time.Duration,
+	fn func(ctx context.Context) error) (bool, error) {
+	clock := getClock()
+	start := clock.Now().Truncate(period)
+	marker := name + ":" + strconv.FormatInt(start.UnixNano()/int64(time.Millisecond), 10)
+
+	var ran bool
+	err := New(redis, name, "").DoWithAutoRefresh(ctx, func(ctx context.Context) error {
+		if n, err := redis.Exists(ctx, marker).Result(); err != nil || n > 0 {
+			return err
+		}
+
+		if err := fn(ctx); err != nil {
+			return err
+		}
+
+		ran = true
+		ttl := start.Add(period).Sub(clock.Now()) + tolerance*time.Millisecond
+		if ttl <= 0 {
+			// the period is over, there's nothing left to dedup.
+			return nil
+		}
+		return redis.Set(ctx, marker, 1, ttl).Err()
+	})
+	if err == ErrNotAcquired {
+		// another process is running it.
+		return false, nil
+	}
+
+	return ran, err
+}
+
+// Debounce reports whether the caller should run the action named name, at
+// most one caller across all the processes gets true per window, e.g. to
+// send an alert or invalidate a cache once however many nodes trigger it.
+// Unlike RunOncePer the windows start at the first trigger.
+func Debounce(ctx context.Context, redis *red.Client, name string, window time.Duration) (bool, error) {
+	return redis.SetNX(ctx, name, newToken(), window).Result()
+}
@@ -0,0 +1,208 @@
+package redislock
+
+import (
+	"errors"
+	red "github.com/go-redis/redis/v8"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// a session lock is free if it's unset or its holder's session key is gone.
+	// The session keys are undeclared, the first line is a Lua comment that
+	// lets Dragonfly run the script anyway.
+	sessionLockCommand = `--!df flags=allow-undeclared-keys
+if redis.call("EXISTS", ARGV[2] .. ARGV[1]) == 0 then
+    return "EXPIRED"
+end
+local holder = redis.call("GET", KEYS[1])
+if not holder or holder == ARGV[1] or redis.call("EXISTS", ARGV[2] .. holder) == 0 then
+    redis.call("SET", KEYS[1], ARGV[1])
+    return "OK"
+end
+return false`
+
+	sessionKeyPrefix = "session:"
+)
+
+var sessionLockScript = red.NewScript(sessionLockCommand)
+
+// ErrSessionExpired is returned when acquiring a lock with an expired session.
+var ErrSessionExpired = errors.New("redislock: session expired")
+
+// A Session keeps many locks alive with a single heartbeat, like Consul
+// sessions. Its locks carry no expire of their own: a lock is held as long
+// as the session key it points to exists, so when the session dies all of
+// its locks are freed together.
+//
+// The lock keys are left in place when a session dies and are taken over by
+// the next acquirer. The scripts read the session key by name, so sessions
+// are not supported on redis cluster.
+type Session struct {
+	redis   *red.Client
+	seconds uint32
+	prefix  string
+	id      string
+	key     string
+	clock   Clock
+	stop    chan struct{}
+	done    chan struct{}
+	stopped sync.Once
+	closed  sync.Once
+	// locks holds the keys of the locks acquired and not yet released,
+	// Close deletes them.
+	mu    sync.Mutex
+	locks map[string]struct{}
+}
+
+// A SessionLock is a lock owned by a Session.
+type SessionLock struct {
+	session *Session
+	keys    []string
+	args    []interface{}
+}
+
+// NewSession returns a Session, locks created from it are prefixed by prefix.
+func NewSession(redis *red.Client, prefix string) *Session {
+	id := newToken()
+	return &Session{
+		redis:   redis,
+		seconds: 10,
+		prefix:  prefix,
+		id:      id,
+		key:     prefix + sessionKeyPrefix + id,
+		clock:   getClock(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		locks:   make(map[string]struct{}),
+	}
+}
+
+// Start creates the session and starts its heartbeat.
+func (s *Session) Start() error {
+	if err := s.redis.Set(tempContext, s.key, 1, s.ttl()).Err(); err != nil {
+		return err
+	}
+
+	go s.heartbeat()
+	return nil
+}
+
+// Close stops the heartbeat and deletes the session, releasing all its locks.
+// The keys of the locks still held are deleted too, the keys left by a
+// session that died without Close are taken over by the next acquirer.
+func (s *Session) Close() error {
+	s.stopped.Do(func() {
+		close(s.stop)
+	})
+	defer s.expire()
+
+	s.mu.Lock()
+	locks := s.locks
+	s.locks = make(map[string]struct{})
+	s.mu.Unlock()
+	var firstErr error
+	for key := range locks {
+		if err := delScript.Run(tempContext, s.redis, []string{key}, s.id).Err(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := s.redis.Del(tempContext, s.key).Err(); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// Done returns a channel that's closed when the session is closed or expired.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// NewLock returns a lock on key owned by s.
+func (s *Session) NewLock(key string) *SessionLock {
+	return &SessionLock{
+		session: s,
+		keys:    []string{s.prefix + key},
+		args:    []interface{}{s.id, s.prefix + sessionKeyPrefix},
+	}
+}
+
+// SetClock sets the clock driving the heartbeat, it must be called before Start.
+func (s *Session) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// SetExpire sets the expire of the session, it must be called before Start.
+func (s *Session) SetExpire(seconds int) {
+	atomic.StoreUint32(&s.seconds, uint32(seconds))
+}
+
+func (s *Session) heartbeat() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.clock.After(s.ttl() / 3):
+			// errors are retried on the next tick, the session is only
+			// given up once redis reports that it's gone.
+			ok, err := s.redis.PExpire(tempContext, s.key, s.ttl()).Result()
+			if err == nil && !ok {
+				s.expire()
+				return
+			}
+		}
+	}
+}
+
+func (s *Session) expire() {
+	s.closed.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *Session) ttl() time.Duration {
+	return time.Duration(atomic.LoadUint32(&s.seconds))*time.Second + tolerance*time.Millisecond
+}
+
+// Acquire acquires the lock for the session.
+func (l *SessionLock) Acquire() (bool, error) {
+	resp, err := sessionLockScript.Run(tempContext, l.session.redis, l.keys, l.args...).Result()
+	if err == red.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	reply, ok := resp.(string)
+	if ok && reply == "EXPIRED" {
+		return false, ErrSessionExpired
+	} else if !ok || reply != "OK" {
+		return false, nil
+	}
+
+	l.session.mu.Lock()
+	l.session.locks[l.keys[0]] = struct{}{}
+	l.session.mu.Unlock()
+	return true, nil
+}
+
+// Release releases the lock.
+func (l *SessionLock) Release() (bool, error) {
+	resp, err := delScript.Run(tempContext, l.session.redis, l.keys, l.args[:1]...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	l.session.mu.Lock()
+	delete(l.session.locks, l.keys[0])
+	l.session.mu.Unlock()
+
+	reply, ok := resp.(int64)
+	if !ok {
+		return false, nil
+	}
+
+	return reply == 1, nil
+}
@@ -0,0 +1,48 @@
+package redislock
+
+import (
+	red "github.com/go-redis/redis/v8"
+	"hash/fnv"
+)
+
+// A Sharder maps a lock key to one of n shards.
+type Sharder func(key string, n int) int
+
+// Sharded creates locks spread over independent redis instances by key, so
+// that the lock traffic scales horizontally without redis cluster. A key
+// always maps to the same instance as long as the instances don't change.
+type Sharded struct {
+	clients []*red.Client
+	sharder Sharder
+}
+
+// NewSharded returns a Sharded over clients, nil sharder hashes the keys
+// with FNV-1a.
+func NewSharded(clients []*red.Client, sharder Sharder) *Sharded {
+	if sharder == nil {
+		sharder = func(key string, n int) int {
+			return int(hashKey(key) % uint32(n))
+		}
+	}
+
+	return &Sharded{
+		clients: clients,
+		sharder: sharder,
+	}
+}
+
+// New returns a RedisLock on the instance of prefix + key.
+func (s *Sharded) New(key string, prefix string) *RedisLock {
+	return New(s.Client(prefix+key), key, prefix)
+}
+
+// Client returns the redis client of the instance holding key.
+func (s *Sharded) Client(key string) *red.Client {
+	return s.clients[s.sharder(key, len(s.clients))]
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
@@ -0,0 +1,81 @@
+package redislock
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// A SlowLock describes a lock held longer than the slow lock threshold.
+type SlowLock struct {
+	Key string
+	// Held is how long the lock has been held so far.
+	Held time.Duration
+	// Stack is the stack of the goroutine that acquired the lock.
+	Stack []byte
+}
+
+type slowConfig struct {
+	threshold time.Duration
+	handler   func(SlowLock)
+}
+
+var slowLocks atomic.Value
+
+func init() {
+	SetSlowLockThreshold(0, nil)
+}
+
+// SetSlowLockThreshold makes the locks report themselves to handler when
+// still held threshold after being acquired, along with the stack captured
+// at acquire time. A nil handler prints a warning in debug mode, and a zero
+// threshold disables the reports and the stack captures.
+func SetSlowLockThreshold(threshold time.Duration, handler func(SlowLock)) {
+	if handler == nil {
+		handler = func(sl SlowLock) {
+			if debugEnabled() {
+				fmt.Printf("key:%s held for %s, acquired at:\n%s\n", sl.Key, sl.Held, sl.Stack)
+			}
+		}
+	}
+	slowLocks.Store(slowConfig{threshold: threshold, handler: handler})
+}
+
+// watchSlow starts the slow lock timer of a newly acquired lock.
+func (rl *RedisLock) watchSlow() {
+	config := slowLocks.Load().(slowConfig)
+	if config.threshold <= 0 {
+		return
+	}
+
+	stack := debug.Stack()
+	timer := rl.clock.AfterFunc(config.threshold, func() {
+		// a lock left to expire is no longer held.
+		if rl.expired() {
+			return
+		}
+		config.handler(SlowLock{
+			Key:   redactKey(rl.key),
+			Held:  config.threshold,
+			Stack: stack,
+		})
+	})
+
+	rl.slowMu.Lock()
+	defer rl.slowMu.Unlock()
+	if rl.slowTimer != nil {
+		rl.slowTimer.Stop()
+	}
+	rl.slowTimer = timer
+}
+
+// unwatchSlow stops the slow lock timer on release or loss.
+func (rl *RedisLock) unwatchSlow() {
+	rl.slowMu.Lock()
+	defer rl.slowMu.Unlock()
+	if rl.slowTimer != nil {
+		rl.slowTimer.Stop()
+		rl.slowTimer = nil
+	}
+}
@@ -0,0 +1,84 @@
+package redislock
+
+import (
+	"context"
+	"fmt"
+	red "github.com/go-redis/redis/v8"
+	"sync/atomic"
+)
+
+// A SplitBrain describes a lock this process believes it holds while redis
+// says otherwise, typically after a failover lost recent writes.
+type SplitBrain struct {
+	Key string
+	// Token is the masked token of the local lock.
+	Token string
+	// Holder is the masked token found in redis, empty if the key is gone.
+	Holder string
+}
+
+var splitBrains atomic.Value
+
+func init() {
+	SetSplitBrainHandler(nil)
+}
+
+// SetSplitBrainHandler sets the function VerifyHeld reports conflicts to.
+// A nil handler prints a warning in debug mode.
+func SetSplitBrainHandler(handler func(SplitBrain)) {
+	if handler == nil {
+		handler = func(sb SplitBrain) {
+			if debugEnabled() {
+				fmt.Printf("key:%s held by %s locally, but by %q in redis\n", sb.Key, sb.Token, sb.Holder)
+			}
+		}
+	}
+	splitBrains.Store(handler)
+}
+
+// VerifyHeld checks the locks this process holds against redis, e.g. after
+// a reconnect or a failover, and returns the ones whose key is gone or
+// holds another token. The conflicting locks are marked Lost, which counts
+// them in Metrics and the audit stream, and reported to the split-brain
+// handler. Locks being extended are skipped, the extend settles them, and
+// so are the locks whose expire elapsed, which are no longer held.
+func VerifyHeld(ctx context.Context) ([]SplitBrain, error) {
+	var conflicts []SplitBrain
+	var err error
+	held.Range(func(k, _ interface{}) bool {
+		rl := k.(*RedisLock)
+		if rl.State() != Held {
+			return true
+		} else if rl.expired() {
+			// left to expire, it's not a conflict.
+			rl.untrack()
+			return true
+		}
+
+		holder, getErr := rl.redis.Get(ctx, rl.key).Result()
+		if getErr != nil && getErr != red.Nil {
+			err = getErr
+			return false
+		} else if holder == rl.id || rl.State() != Held {
+			// released or extended meanwhile.
+			return true
+		} else if rl.expired() {
+			rl.untrack()
+			return true
+		}
+
+		sb := SplitBrain{
+			Key:   redactKey(rl.key),
+			Token: maskToken(rl.id),
+		}
+		if holder != "" {
+			sb.Holder = maskToken(holder)
+		}
+		rl.settle(Held, Lost)
+		splitBrains.Load().(func(SplitBrain))(sb)
+		conflicts = append(conflicts, sb)
+		return true
+	})
+
+	return conflicts, err
+}
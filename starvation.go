@@ -0,0 +1,59 @@
+package redislock
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// A Starvation describes a waiter that failed to acquire a lock for longer
+// than the starvation threshold.
+type Starvation struct {
+	Key string
+	// Holder is the token of the holder at the last attempt.
+	Holder string
+	// Waited is how long the waiter has been trying so far.
+	Waited time.Duration
+}
+
+type starvationConfig struct {
+	threshold time.Duration
+	handler   func(Starvation)
+}
+
+var starvations atomic.Value
+
+func init() {
+	SetStarvationThreshold(0, nil)
+}
+
+// SetStarvationThreshold makes TryLockTimeout report to handler, once per
+// call, when it has failed to acquire the lock for longer than threshold,
+// so hot locks get noticed. A nil handler prints a warning in debug mode,
+// and a zero threshold disables the reports.
+func SetStarvationThreshold(threshold time.Duration, handler func(Starvation)) {
+	if handler == nil {
+		handler = func(s Starvation) {
+			if debugEnabled() {
+				fmt.Printf("key:%s starved for %s, held by:%s\n", s.Key, s.Waited, maskToken(s.Holder))
+			}
+		}
+	}
+	starvations.Store(starvationConfig{threshold: threshold, handler: handler})
+}
+
+// reportStarvation reports the waiter if it waited past the threshold, and
+// returns whether it did.
+func (rl *RedisLock) reportStarvation(waited time.Duration, holder string) bool {
+	config := starvations.Load().(starvationConfig)
+	if config.threshold <= 0 || waited < config.threshold {
+		return false
+	}
+
+	config.handler(Starvation{
+		Key:    redactKey(rl.key),
+		Holder: holder,
+		Waited: waited,
+	})
+	return true
+}
@@ -0,0 +1,91 @@
+package redislock
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// A State is the state of a RedisLock as seen by its owner.
+type State int32
+
+const (
+	// Unlocked is the state of a lock that was never acquired.
+	Unlocked State = iota
+	// Acquiring is the state while an acquire is in flight.
+	Acquiring
+	// Held is the state of an acquired lock.
+	Held
+	// Extending is the state while an extend is in flight.
+	Extending
+	// Lost is the state of a lock that was found held by others.
+	Lost
+	// Released is the state of a released lock.
+	Released
+)
+
+// ErrInvalidState is returned when an operation isn't allowed in the current
+// state of the lock, e.g. extending a lock that was never acquired.
+var ErrInvalidState = errors.New("redislock: invalid lock state")
+
+var stateNames = [...]string{"unlocked", "acquiring", "held", "extending", "lost", "released"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", int32(s))
+	}
+
+	return stateNames[s]
+}
+
+// State returns the state of the lock.
+func (rl *RedisLock) State() State {
+	return State(atomic.LoadInt32(&rl.state))
+}
+
+// transition moves the lock to the state to if it's in one of the states
+// from, and returns the state it was in.
+func (rl *RedisLock) transition(op string, to State, from ...State) (State, error) {
+	for {
+		cur := rl.State()
+		allowed := false
+		for _, s := range from {
+			allowed = allowed || s == cur
+		}
+		if !allowed {
+			return cur, fmt.Errorf("%w: cannot %s a %s lock", ErrInvalidState, op, cur)
+		}
+
+		if atomic.CompareAndSwapInt32(&rl.state, int32(cur), int32(to)) {
+			return cur, nil
+		}
+	}
+}
+
+// settle moves the lock from the state from to the state to, unless another
+// operation changed the state meanwhile, e.g. a release during an extend.
+func (rl *RedisLock) settle(from, to State) {
+	if !atomic.CompareAndSwapInt32(&rl.state, int32(from), int32(to)) {
+		return
+	}
+
+	switch to {
+	case Held:
+		rl.track()
+	case Lost:
+		rl.unwatchSlow()
+		rl.untrack()
+		getMetrics().IncError(rl.metricKey(), ErrorLost)
+		rl.audit(AuditLost)
+	}
+}
+
+// startHold records the start of a new hold of the lock for seconds, 0 for
+// the expire set by SetExpire.
+func (rl *RedisLock) startHold(seconds uint32) {
+	atomic.StoreUint32(&rl.holdSeconds, seconds)
+	atomic.StoreInt64(&rl.acquiredAt, rl.clock.Now().UnixNano())
+	rl.renewHold(rl.validity())
+	rl.watchSlow()
+	rl.audit(AuditAcquire)
+}
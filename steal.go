@@ -0,0 +1,93 @@
+package redislock
+
+import (
+	red "github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+// stealCommand takes the lock over if its holder didn't renew it for
+// ARGV[3] milliseconds, assuming the holder uses the expire ARGV[2], and
+// tells the previous holder on the lost channel.
+const stealCommand = `local holder = redis.call("GET", KEYS[1])
+if holder and holder ~= ARGV[1] and
+    redis.call("PTTL", KEYS[1]) > tonumber(ARGV[2]) - tonumber(ARGV[3]) then
+    return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+if holder and holder ~= ARGV[1] then
+    redis.call("PUBLISH", KEYS[1] .. ARGV[4], holder)
+end
+return 1`
+
+const lostChannelSuffix = ":lost"
+
+var stealScript = red.NewScript(stealCommand)
+
+// Steal acquires the lock, taking it over from a holder that didn't renew it
+// within grace. It's an opt-in policy for workloads where a stalled holder
+// is worse than a lost exclusivity: the previous holder may still run until
+// it notices the loss, on its next Extend or through WatchLoss.
+//
+// The time since the last renewal is derived from the remaining ttl of the
+// key, so the holders must use the same expire as rl.
+func (rl *RedisLock) Steal(grace time.Duration) (bool, error) {
+	if rl.mirrorKeys != nil {
+		return false, ErrMirrored
+	}
+	prev, err := rl.transition("steal", Acquiring, Unlocked, Lost, Released)
+	if err != nil {
+		return false, err
+	}
+	took, err := rl.beginHold(0)
+	if err != nil {
+		rl.settle(Acquiring, prev)
+		return false, err
+	}
+	rl.stampValue()
+
+	args := rl.lockArgs.Load().([]interface{})
+	resp, err := stealScript.Run(tempContext, rl.redis, rl.keys, args[0], args[1],
+		strconv.FormatInt(int64(grace/time.Millisecond), 10), lostChannelSuffix).Int()
+	if err != nil || resp != 1 {
+		if took {
+			rl.releaseSlot()
+		}
+		rl.settle(Acquiring, prev)
+		return false, err
+	}
+
+	rl.startHold(0)
+	rl.settle(Acquiring, Held)
+	return true, nil
+}
+
+// WatchLoss makes the Guard listen for its lock being stolen with Steal, and
+// close Done as soon as it is.
+func (g *Guard) WatchLoss() {
+	sub := g.lock.redis.Subscribe(tempContext, g.lock.key+lostChannelSuffix)
+	if _, err := sub.Receive(tempContext); err != nil {
+		_ = sub.Close()
+		return
+	}
+
+	go func() {
+		defer sub.Close()
+
+		messages := channel(sub)
+		for {
+			select {
+			case <-g.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				} else if msg.Payload == g.lock.id {
+					g.lock.settle(Held, Lost)
+					g.stop()
+					return
+				}
+			}
+		}
+	}()
+}
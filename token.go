@@ -0,0 +1,114 @@
+package redislock
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// tokenSource holds the func() string generating lock and session tokens.
+var tokenSource atomic.Value
+
+func init() {
+	SetTokenSource(nil)
+}
+
+// SetTokenSource sets the function generating the tokens of new locks and
+// sessions, e.g. a deterministic sequence in tests. The tokens must be unique
+// across all the processes sharing the locks. A nil source restores the
+// default random tokens.
+func SetTokenSource(source func() string) {
+	if source == nil {
+		source = func() string {
+			return randomStr(randomLen)
+		}
+	}
+	tokenSource.Store(source)
+}
+
+// ULIDToken returns a ULID, a token source whose tokens sort by creation
+// time to the millisecond.
+func ULIDToken() string {
+	var b [16]byte
+	timeOrdered(b[:])
+
+	// 128 bits as 26 base32 digits, the first one only carries 3 bits.
+	out := make([]byte, 26)
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// UUIDv7Token returns a UUID version 7, a token source whose tokens sort by
+// creation time to the millisecond.
+func UUIDv7Token() string {
+	var b [16]byte
+	timeOrdered(b[:])
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+
+	out := make([]byte, 36)
+	hex.Encode(out[0:8], b[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], b[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], b[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], b[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], b[10:])
+	return string(out)
+}
+
+// IdentityToken returns a token source prefixing random tokens with the
+// service name, the hostname and the PID of the process, such as
+// "billing@web-3:4242:abcd...", so that reading a lock key tells which
+// instance holds it. A nil next uses the default random tokens.
+func IdentityToken(service string, next func() string) func() string {
+	if next == nil {
+		next = func() string {
+			return randomStr(randomLen)
+		}
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	prefix := host + ":" + strconv.Itoa(os.Getpid()) + ":"
+	if service != "" {
+		prefix = service + "@" + prefix
+	}
+
+	return func() string {
+		return prefix + next()
+	}
+}
+
+// timeOrdered fills b with the unix time in milliseconds on 48 bits
+// followed by random bytes.
+func timeOrdered(b []byte) {
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	if _, err := crand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+}
+
+func newToken() string {
+	return tokenSource.Load().(func() string)()
+}
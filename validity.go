@@ -0,0 +1,148 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	red "github.com/go-redis/redis/v8"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// pttlCommand returns the PTTL of the key if it's held by ARGV[1], or -3.
+const pttlCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("PTTL", KEYS[1])
+else
+    return -3
+end`
+
+// extendBelowCommand extends the key to ARGV[3] milliseconds if it's held
+// by ARGV[1] for less than ARGV[2], it returns 2 when no extend is needed.
+const extendBelowCommand = `if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+    return 0
+end
+if redis.call("PTTL", KEYS[1]) >= tonumber(ARGV[2]) then
+    return 2
+end
+return redis.call("PEXPIRE", KEYS[1], ARGV[3])`
+
+var (
+	pttlScript        = red.NewScript(pttlCommand)
+	extendBelowScript = red.NewScript(extendBelowCommand)
+)
+
+var (
+	// ErrNotHeld is returned when a lock is expected to be held but isn't.
+	ErrNotHeld = errors.New("redislock: lock not held")
+	// ErrInsufficientValidity is returned when a lock is held for less
+	// than the required duration.
+	ErrInsufficientValidity = errors.New("redislock: insufficient lock validity")
+)
+
+// Validity returns how long the lock is still held for, or ErrNotHeld.
+func (rl *RedisLock) Validity(ctx context.Context) (time.Duration, error) {
+	resp, err := pttlScript.Run(ctx, rl.redis, rl.keys, rl.idArgs...).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	pttl, _ := resp.(int64)
+	if pttl < 0 {
+		return 0, ErrNotHeld
+	}
+
+	validity := time.Duration(pttl)*time.Millisecond - tolerance*time.Millisecond
+	if validity < 0 {
+		validity = 0
+	}
+
+	return validity, nil
+}
+
+// RequireValidity returns ErrInsufficientValidity if the lock is held for
+// less than d, or ErrNotHeld if it's not held at all.
+func (rl *RedisLock) RequireValidity(d time.Duration) error {
+	validity, err := rl.Validity(tempContext)
+	if err != nil {
+		return err
+	} else if validity < d {
+		return ErrInsufficientValidity
+	}
+
+	return nil
+}
+
+// EnsureValidity makes sure the lock is held for at least d, extending it
+// if needed. It returns ErrInsufficientValidity if d is longer than the
+// expire of the lock.
+func (rl *RedisLock) EnsureValidity(ctx context.Context, d time.Duration) error {
+	validity, err := rl.Validity(ctx)
+	if err != nil {
+		return err
+	} else if validity >= d {
+		return nil
+	}
+
+	if ok, err := rl.extend(ctx); err != nil {
+		return err
+	} else if !ok {
+		return ErrNotHeld
+	} else if rl.validity() < d {
+		return ErrInsufficientValidity
+	}
+
+	return nil
+}
+
+// ExtendIfBelow extends the lock to newTTL only if it's held for less than
+// threshold, so heartbeats of long locks mostly don't write. It returns
+// whether the lock is still held, extended or not. newTTL is capped like
+// the expire of the lock.
+func (rl *RedisLock) ExtendIfBelow(threshold, newTTL time.Duration) (bool, error) {
+	if limit := time.Duration(rl.maxExpire) * time.Second; limit > 0 && newTTL > limit {
+		if rl.rejectLongExpire {
+			return false, ErrExpireTooLong
+		}
+		newTTL = limit
+	}
+	if _, err := rl.transition("extend", Extending, Held); err != nil {
+		return false, err
+	}
+	took, err := rl.beginHold(atomic.LoadUint32(&rl.holdSeconds))
+	if err != nil {
+		rl.settle(Extending, Held)
+		return false, err
+	}
+
+	below := strconv.FormatInt(int64(threshold/time.Millisecond)+tolerance, 10)
+	ttl := strconv.FormatInt(int64(newTTL/time.Millisecond)+tolerance, 10)
+	start := rl.clock.Now()
+	resp, err := extendBelowScript.Run(tempContext, rl.redis, rl.keys, rl.id, below, ttl).Int()
+	if err == nil && resp != 0 && rl.mirrorKeys != nil {
+		// the mirror is extended along with the lock key, or lost with it.
+		var mirror int
+		if mirror, err = extendBelowScript.Run(tempContext, rl.redis, rl.mirrorKeys, rl.id, below, ttl).Int(); err == nil && mirror == 0 {
+			resp = 0
+		}
+	}
+	rl.debugOp("extend", start, err == nil && resp != 0, err)
+	if err != nil {
+		if took {
+			rl.releaseSlot()
+		}
+		rl.settle(Extending, Held)
+		return false, err
+	} else if resp == 0 {
+		rl.settle(Extending, Lost)
+		return false, nil
+	}
+
+	if resp == 1 {
+		rl.renewHold(newTTL)
+	}
+	rl.settle(Extending, Held)
+	if resp == 1 {
+		rl.audit(AuditExtend)
+	}
+	return true, nil
+}
@@ -0,0 +1,139 @@
+package redislock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookFlushTimeout is the longest StartWebhook takes to send the pending
+// events once its context is done.
+const webhookFlushTimeout = 5 * time.Second
+
+// A WebhookConfig configures the sink started by StartWebhook. The zero
+// values of the optional fields pick the defaults.
+type WebhookConfig struct {
+	URL string
+	// Client sends the requests, http.DefaultClient by default.
+	Client *http.Client
+	// BatchSize is the most events sent in one request, 100 by default.
+	BatchSize int
+	// FlushInterval is the longest an event waits for its batch to fill,
+	// 1s by default.
+	FlushInterval time.Duration
+	// Retries is the number of retries of a failed request, with a doubling
+	// backoff from 100ms. The batch is dropped once they are exhausted.
+	Retries int
+	// OnError, if not nil, is called with the error of dropped batches.
+	OnError func(err error)
+}
+
+// StartWebhook starts posting the lifecycle events of the locks, see Events,
+// to an HTTP endpoint until ctx is done, e.g. to route them to chat or
+// incident tooling. The events are posted in batches as a JSON array with
+// masked tokens, and a response other than 2xx is retried. The pending
+// events are still posted once ctx is done.
+func StartWebhook(ctx context.Context, c WebhookConfig) {
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = time.Second
+	}
+
+	events := subscribe()
+	clock := getClock()
+	go func() {
+		defer unsubscribe(events)
+
+		batch := make([]Event, 0, c.BatchSize)
+		flush := func(ctx context.Context) {
+			if len(batch) == 0 {
+				return
+			}
+			if err := c.post(ctx, batch); err != nil && c.OnError != nil {
+				c.OnError(err)
+			}
+			batch = batch[:0]
+		}
+		add := func(ctx context.Context, e Event) {
+			// a token is enough to release the lock, it's not sent out.
+			e.Token = maskToken(e.Token)
+			if batch = append(batch, e); len(batch) >= c.BatchSize {
+				flush(ctx)
+			}
+		}
+
+		tick := clock.After(c.FlushInterval)
+		for {
+			select {
+			case <-ctx.Done():
+				// send what is pending, ctx can't be used for it anymore.
+				ctx, cancel := context.WithTimeout(context.Background(), webhookFlushTimeout)
+				defer cancel()
+				for pending := true; pending; {
+					select {
+					case e := <-events:
+						add(ctx, e)
+					default:
+						pending = false
+					}
+				}
+				flush(ctx)
+				return
+			case e := <-events:
+				add(ctx, e)
+			case <-tick:
+				flush(ctx)
+				tick = clock.After(c.FlushInterval)
+			}
+		}
+	}()
+}
+
+// post sends batch with the retries of c.
+func (c WebhookConfig) post(ctx context.Context, batch []Event) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		if err = c.send(ctx, body); err == nil || attempt >= c.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-getClock().After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c WebhookConfig) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("redislock: webhook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package redislock
+
+import "context"
+
+const yieldChannelSuffix = ":yield"
+
+// RequestYield asks the holder of the lock to release it early, e.g. for a
+// high priority operation. The holder may ignore the request. It returns the
+// number of holders listening for requests.
+func (rl *RedisLock) RequestYield(ctx context.Context) (int64, error) {
+	return rl.redis.Publish(ctx, rl.key+yieldChannelSuffix, rl.id).Result()
+}
+
+// YieldRequests returns a channel receiving the tokens of the waiters asking
+// the holder to yield with RequestYield, so the holder can checkpoint and
+// release early. The requests sent before the call are not received, and
+// the channel is closed once Done is.
+func (g *Guard) YieldRequests() <-chan string {
+	requests := make(chan string, 1)
+	sub := g.lock.redis.Subscribe(tempContext, g.lock.key+yieldChannelSuffix)
+	// wait for the subscription so no later request is missed.
+	if _, err := sub.Receive(tempContext); err != nil {
+		_ = sub.Close()
+		close(requests)
+		return requests
+	}
+
+	go func() {
+		defer close(requests)
+		defer sub.Close()
+
+		messages := channel(sub)
+		for {
+			select {
+			case <-g.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				// drop requests while one is pending, they ask the same.
+				select {
+				case requests <- msg.Payload:
+				default:
+				}
+			}
+		}
+	}()
+
+	return requests
+}